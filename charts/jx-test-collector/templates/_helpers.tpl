@@ -60,3 +60,10 @@ Create the name of the service account to use
     {{ default "default" .Values.serviceAccount.name }}
 {{- end -}}
 {{- end -}}
+
+{{/*
+Returns true if the web server authenticates requests with TokenReviews and SubjectAccessReviews.
+*/}}
+{{- define "jx-test-collector.kubernetesAuth" -}}
+{{- eq (get (.Values.env | default dict) "AUTH_MODE" | toString) "kubernetes" -}}
+{{- end -}}
@@ -0,0 +1,173 @@
+package diskguard
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Usage the usage of a file system
+type Usage struct {
+	// Total the size of the file system in bytes
+	Total uint64
+
+	// Free the bytes available to unprivileged users
+	Free uint64
+}
+
+// Percent returns the percentage of the file system which is used
+func (u Usage) Percent() float64 {
+	if u.Total == 0 {
+		return 0
+	}
+	return float64(u.Total-u.Free) * 100 / float64(u.Total)
+}
+
+// Options monitors the usage of the file system of the work directory.
+//
+// When the usage reaches the high watermark new work is paused and OnHigh is invoked to free up space.
+// Work resumes once the usage drops to the low watermark
+type Options struct {
+	// Dir the directory to monitor
+	Dir string
+
+	// HighWatermark the percentage of disk usage at which new tails are paused and local files are evicted
+	HighWatermark float64 `env:"DISK_HIGH_WATERMARK,default=90"`
+
+	// LowWatermark the percentage of disk usage below which new tails are resumed
+	LowWatermark float64 `env:"DISK_LOW_WATERMARK,default=75"`
+
+	// CheckInterval how often the disk usage is checked
+	CheckInterval time.Duration `env:"DISK_CHECK_INTERVAL,default=30s"`
+
+	// EvictMinAge the minimum time since a synchronised file was last modified before it can be evicted
+	EvictMinAge time.Duration `env:"DISK_EVICT_MIN_AGE,default=10m"`
+
+	// NoDiskGuard disables the monitoring of the disk usage
+	NoDiskGuard bool `env:"NO_DISK_GUARD"`
+
+	// OnHigh invoked on each check while the usage is above the high watermark to free up space
+	OnHigh func() error
+
+	// GetUsage returns the usage of the directory. Defaults to GetUsage
+	GetUsage func(dir string) (Usage, error)
+
+	lock    sync.Mutex
+	usage   Usage
+	paused  bool
+	resumed chan struct{}
+}
+
+// Start checks the disk usage periodically until the context is done
+func (o *Options) Start(ctx context.Context) {
+	if o.NoDiskGuard {
+		return
+	}
+	interval := o.CheckInterval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			err := o.Check()
+			if err != nil {
+				logrus.WithError(err).Warn("failed to check disk usage")
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Check checks the disk usage, pausing or resuming and freeing up space if required
+func (o *Options) Check() error {
+	getUsage := o.GetUsage
+	if getUsage == nil {
+		getUsage = GetUsage
+	}
+	usage, err := getUsage(o.Dir)
+	if err != nil {
+		return err
+	}
+	high := o.setUsage(usage)
+	if !high || o.OnHigh == nil {
+		return nil
+	}
+	err = o.OnHigh()
+	if err != nil {
+		return errors.Wrapf(err, "failed to free up disk space")
+	}
+
+	// lets check if we have freed enough space to resume
+	usage, err = getUsage(o.Dir)
+	if err != nil {
+		return err
+	}
+	o.setUsage(usage)
+	return nil
+}
+
+// setUsage updates the usage returning true if the usage is above the high watermark
+func (o *Options) setUsage(usage Usage) bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.usage = usage
+	percent := usage.Percent()
+	high := percent >= o.HighWatermark && o.HighWatermark > 0
+	log := logrus.WithFields(map[string]interface{}{
+		"Dir":   o.Dir,
+		"Usage": fmt.Sprintf("%.1f%%", percent),
+	})
+	switch {
+	case high && !o.paused:
+		log.Warn("disk usage is above the high watermark so pausing new tails")
+		o.paused = true
+		o.resumed = make(chan struct{})
+	case o.paused && percent <= o.LowWatermark:
+		log.Info("disk usage is below the low watermark so resuming new tails")
+		o.paused = false
+		close(o.resumed)
+	}
+	return high
+}
+
+// Paused returns true if new work is paused as the disk usage reached the high watermark
+func (o *Options) Paused() bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.paused
+}
+
+// Resumed returns a channel which is closed when new work can be resumed
+func (o *Options) Resumed() <-chan struct{} {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if !o.paused {
+		ch := make(chan struct{})
+		close(ch)
+		return ch
+	}
+	return o.resumed
+}
+
+// Ready returns an error if new work is paused due to the disk usage
+func (o *Options) Ready() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.paused {
+		return errors.Errorf("disk usage of %s is %.1f%% which is above the high watermark of %.1f%%", o.Dir, o.usage.Percent(), o.HighWatermark)
+	}
+	return nil
+}
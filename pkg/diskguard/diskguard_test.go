@@ -0,0 +1,69 @@
+package diskguard_test
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/diskguard"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatermarks(t *testing.T) {
+	used := uint64(50)
+	freed := 0
+	o := &diskguard.Options{
+		Dir:           "work",
+		HighWatermark: 90,
+		LowWatermark:  75,
+		GetUsage: func(dir string) (diskguard.Usage, error) {
+			return diskguard.Usage{Total: 100, Free: 100 - used}, nil
+		},
+		OnHigh: func() error {
+			freed++
+			used -= 5
+			return nil
+		},
+	}
+
+	testCases := []struct {
+		used          uint64
+		expectPaused  bool
+		expectedFreed int
+	}{
+		{used: 50, expectPaused: false, expectedFreed: 0},
+		{used: 95, expectPaused: true, expectedFreed: 1},
+		{used: 80, expectPaused: true, expectedFreed: 1},
+		{used: 92, expectPaused: true, expectedFreed: 2},
+		{used: 70, expectPaused: false, expectedFreed: 2},
+		{used: 80, expectPaused: false, expectedFreed: 2},
+	}
+	for i, tc := range testCases {
+		used = tc.used
+		err := o.Check()
+		require.NoError(t, err, "failed to check disk usage for case %d", i)
+
+		assert.Equal(t, tc.expectPaused, o.Paused(), "paused for case %d", i)
+		assert.Equal(t, tc.expectedFreed, freed, "number of times space was freed for case %d", i)
+		if tc.expectPaused {
+			assert.Error(t, o.Ready(), "ready for case %d", i)
+		} else {
+			assert.NoError(t, o.Ready(), "ready for case %d", i)
+			select {
+			case <-o.Resumed():
+			default:
+				assert.Fail(t, "resumed channel should be closed", "case %d", i)
+			}
+		}
+	}
+}
+
+func TestGetUsage(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	usage, err := diskguard.GetUsage(tmpDir)
+	require.NoError(t, err, "failed to get usage of %s", tmpDir)
+	assert.True(t, usage.Total > 0, "total size of the file system should be positive")
+	assert.True(t, usage.Free <= usage.Total, "free space should not exceed the total")
+}
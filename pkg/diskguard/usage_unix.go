@@ -0,0 +1,24 @@
+//go:build !windows
+// +build !windows
+
+package diskguard
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// GetUsage returns the usage of the file system containing the given directory
+func GetUsage(dir string) (Usage, error) {
+	stat := syscall.Statfs_t{}
+	err := syscall.Statfs(dir, &stat)
+	if err != nil {
+		return Usage{}, errors.Wrapf(err, "failed to stat file system of %s", dir)
+	}
+	blockSize := uint64(stat.Bsize)
+	return Usage{
+		Total: uint64(stat.Blocks) * blockSize,
+		Free:  uint64(stat.Bavail) * blockSize,
+	}, nil
+}
@@ -0,0 +1,35 @@
+//go:build windows
+// +build windows
+
+package diskguard
+
+import (
+	"syscall"
+	"unsafe"
+
+	"github.com/pkg/errors"
+)
+
+var getDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// GetUsage returns the usage of the file system containing the given directory
+func GetUsage(dir string) (Usage, error) {
+	path, err := syscall.UTF16PtrFromString(dir)
+	if err != nil {
+		return Usage{}, errors.Wrapf(err, "invalid directory %s", dir)
+	}
+	var free, total, totalFree uint64
+	r, _, err := getDiskFreeSpaceEx.Call(
+		uintptr(unsafe.Pointer(path)),
+		uintptr(unsafe.Pointer(&free)),
+		uintptr(unsafe.Pointer(&total)),
+		uintptr(unsafe.Pointer(&totalFree)),
+	)
+	if r == 0 {
+		return Usage{}, errors.Wrapf(err, "failed to get disk free space of %s", dir)
+	}
+	return Usage{
+		Total: total,
+		Free:  free,
+	}, nil
+}
@@ -0,0 +1,305 @@
+package flaky
+
+import (
+	"encoding/json"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
+	"github.com/jenkins-x/jx-test-collector/pkg/testresults"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// JSONFileName the name of the JSON flaky tests report
+	JSONFileName = "flaky-tests.json"
+
+	// HTMLFileName the name of the HTML flaky tests report
+	HTMLFileName = "flaky-tests.html"
+)
+
+// Report the flaky tests found for each repository branch
+type Report struct {
+	Generated time.Time `json:"generated"`
+	Branches  []*Branch `json:"branches"`
+}
+
+// Branch the flaky tests for a branch of a repository
+type Branch struct {
+	Owner      string  `json:"owner"`
+	Repository string  `json:"repository"`
+	Branch     string  `json:"branch"`
+	Runs       int     `json:"runs"`
+	Tests      []*Test `json:"tests"`
+}
+
+// Test the pass/fail history of a test that has been flagged as flaky
+type Test struct {
+	Suite  string `json:"suite,omitempty"`
+	Name   string `json:"name"`
+	Passed int    `json:"passed"`
+	Failed int    `json:"failed"`
+
+	// Flips the number of times the status changed between consecutive builds
+	Flips int `json:"flips"`
+
+	// Commits the commits which both passed and failed the test
+	Commits []string   `json:"commits"`
+	History []*Outcome `json:"history"`
+}
+
+// Outcome the status of a test in a pipeline run
+type Outcome struct {
+	PipelineRun string             `json:"pipelineRun,omitempty"`
+	Build       string             `json:"build,omitempty"`
+	Commit      string             `json:"commit,omitempty"`
+	Status      testresults.Status `json:"status"`
+}
+
+// Options the options for generating the flaky test reports
+type Options struct {
+	// Dir the directory containing the test results of the pipeline runs
+	Dir string
+
+	// OutDir the directory the reports are written to
+	OutDir string
+}
+
+// Run generates the flaky test reports. The reports are only written if the flaky tests have changed
+// so that an unchanged report is not committed on every sync
+func (o *Options) Run() error {
+	report, err := Generate(o.Dir)
+	if err != nil {
+		return errors.Wrapf(err, "failed to generate flaky tests report")
+	}
+
+	if !o.changed(report) {
+		return nil
+	}
+
+	err = os.MkdirAll(o.OutDir, files.DefaultDirWritePermissions)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create directory %s", o.OutDir)
+	}
+
+	fileName := filepath.Join(o.OutDir, JSONFileName)
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal flaky tests report")
+	}
+	err = ioutil.WriteFile(fileName, data, files.DefaultFileWritePermissions)
+	if err != nil {
+		return errors.Wrapf(err, "failed to save file %s", fileName)
+	}
+
+	fileName = filepath.Join(o.OutDir, HTMLFileName)
+	f, err := os.Create(fileName)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create file %s", fileName)
+	}
+	defer f.Close()
+	err = htmlTemplate.Execute(f, report)
+	if err != nil {
+		return errors.Wrapf(err, "failed to render file %s", fileName)
+	}
+	return nil
+}
+
+// changed returns true if the flaky tests in the report differ from the reports already written
+func (o *Options) changed(report *Report) bool {
+	exists, err := files.FileExists(filepath.Join(o.OutDir, HTMLFileName))
+	if err != nil || !exists {
+		return true
+	}
+	data, err := ioutil.ReadFile(filepath.Join(o.OutDir, JSONFileName))
+	if err != nil {
+		return true
+	}
+	previous := &Report{}
+	err = json.Unmarshal(data, previous)
+	if err != nil {
+		return true
+	}
+	oldData, err := json.Marshal(previous.Branches)
+	if err != nil {
+		return true
+	}
+	newData, err := json.Marshal(report.Branches)
+	if err != nil {
+		return true
+	}
+	return string(oldData) != string(newData)
+}
+
+// Generate finds the test results of all the pipeline runs in the given directory
+// and returns the tests which both passed and failed on the same commit
+func Generate(dir string) (*Report, error) {
+	branches := map[string][]*testresults.Run{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != testresults.FileName {
+			return nil
+		}
+		run, err := testresults.Load(path)
+		if err != nil {
+			logrus.WithError(err).Warnf("ignoring test results %s", path)
+			return nil
+		}
+		if run.Repository == "" {
+			return nil
+		}
+		key := strings.Join([]string{run.Owner, run.Repository, run.Branch}, "/")
+		branches[key] = append(branches[key], run)
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "failed to find test results in dir %s", dir)
+	}
+
+	report := &Report{
+		Generated: time.Now().UTC(),
+	}
+	for _, runs := range branches {
+		b := findFlakyTests(runs)
+		if len(b.Tests) > 0 {
+			report.Branches = append(report.Branches, b)
+		}
+	}
+	sort.Slice(report.Branches, func(i, j int) bool {
+		b1 := report.Branches[i]
+		b2 := report.Branches[j]
+		return strings.Join([]string{b1.Owner, b1.Repository, b1.Branch}, "/") < strings.Join([]string{b2.Owner, b2.Repository, b2.Branch}, "/")
+	})
+	return report, nil
+}
+
+func findFlakyTests(runs []*testresults.Run) *Branch {
+	sort.SliceStable(runs, func(i, j int) bool {
+		return buildLess(runs[i].Build, runs[j].Build)
+	})
+	b := &Branch{
+		Owner:      runs[0].Owner,
+		Repository: runs[0].Repository,
+		Branch:     runs[0].Branch,
+		Runs:       len(runs),
+	}
+
+	tests := map[string]*Test{}
+	var keys []string
+	for _, run := range runs {
+		for i := range run.Cases {
+			c := &run.Cases[i]
+			if c.Status == testresults.StatusSkipped {
+				continue
+			}
+			key := c.Suite + "\n" + c.Name
+			t := tests[key]
+			if t == nil {
+				t = &Test{
+					Suite: c.Suite,
+					Name:  c.Name,
+				}
+				tests[key] = t
+				keys = append(keys, key)
+			}
+			if c.Status == testresults.StatusPassed {
+				t.Passed++
+			} else {
+				t.Failed++
+			}
+			t.History = append(t.History, &Outcome{
+				PipelineRun: run.PipelineRun,
+				Build:       run.Build,
+				Commit:      run.Commit,
+				Status:      c.Status,
+			})
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		t := tests[key]
+		commits := map[string]map[bool]bool{}
+		for i, h := range t.History {
+			passed := h.Status == testresults.StatusPassed
+			if i > 0 && passed != (t.History[i-1].Status == testresults.StatusPassed) {
+				t.Flips++
+			}
+			if h.Commit == "" {
+				continue
+			}
+			if commits[h.Commit] == nil {
+				commits[h.Commit] = map[bool]bool{}
+			}
+			commits[h.Commit][passed] = true
+		}
+		for commit, statuses := range commits {
+			if statuses[true] && statuses[false] {
+				t.Commits = append(t.Commits, commit)
+			}
+		}
+		if len(t.Commits) > 0 {
+			sort.Strings(t.Commits)
+			b.Tests = append(b.Tests, t)
+		}
+	}
+	return b
+}
+
+// buildLess compares build numbers numerically if possible
+func buildLess(b1, b2 string) bool {
+	n1, err1 := strconv.Atoi(b1)
+	n2, err2 := strconv.Atoi(b2)
+	if err1 == nil && err2 == nil {
+		return n1 < n2
+	}
+	return b1 < b2
+}
+
+var htmlTemplate = template.Must(template.New("flaky").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Flaky Tests</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+.passed { color: #2a7d2a; }
+.failed, .error { color: #c62828; }
+</style>
+</head>
+<body>
+<h1>Flaky Tests</h1>
+<p>Generated {{ .Generated.Format "2006-01-02 15:04:05 MST" }}</p>
+{{- range .Branches }}
+<h2>{{ .Owner }}/{{ .Repository }} {{ .Branch }}</h2>
+<p>{{ .Runs }} pipeline runs</p>
+<table>
+<tr><th>Suite</th><th>Test</th><th>Passed</th><th>Failed</th><th>Flips</th><th>History</th></tr>
+{{- range .Tests }}
+<tr>
+<td>{{ .Suite }}</td>
+<td>{{ .Name }}</td>
+<td>{{ .Passed }}</td>
+<td>{{ .Failed }}</td>
+<td>{{ .Flips }}</td>
+<td>{{ range .History }}<span class="{{ .Status }}" title="{{ .PipelineRun }} {{ .Commit }}">#{{ .Build }}</span> {{ end }}</td>
+</tr>
+{{- end }}
+</table>
+{{- else }}
+<p>No flaky tests found.</p>
+{{- end }}
+</body>
+</html>
+`))
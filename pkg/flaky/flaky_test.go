@@ -0,0 +1,81 @@
+package flaky_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/flaky"
+	"github.com/jenkins-x/jx-test-collector/pkg/testresults"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFlakyTests(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+	t.Logf("running in dir %s", tmpDir)
+
+	logDir := filepath.Join(tmpDir, "logs")
+	builds := []struct {
+		commit string
+		stable testresults.Status
+		flaky  testresults.Status
+	}{
+		{"abc", testresults.StatusPassed, testresults.StatusPassed},
+		{"abc", testresults.StatusPassed, testresults.StatusFailed},
+		{"def", testresults.StatusFailed, testresults.StatusPassed},
+		{"ghi", testresults.StatusPassed, testresults.StatusPassed},
+	}
+	for i, b := range builds {
+		build := strconv.Itoa(i + 1)
+		run := &testresults.Run{
+			Namespace:   "jx",
+			PipelineRun: "myorg-myrepo-pr-1-" + build,
+			Owner:       "myorg",
+			Repository:  "myrepo",
+			Branch:      "PR-1",
+			Build:       build,
+			Commit:      b.commit,
+		}
+		run.Replace("gotest", []testresults.Case{
+			{Suite: "cheese", Name: "TestStable", Status: b.stable},
+			{Suite: "cheese", Name: "TestFlaky", Status: b.flaky},
+		})
+		err = run.Save(filepath.Join(logDir, "jx", "tekton-pipelines", "myorg", "myrepo", "PR-1", run.PipelineRun, testresults.FileName))
+		require.NoError(t, err, "failed to save test results")
+	}
+
+	o := &flaky.Options{
+		Dir:    logDir,
+		OutDir: filepath.Join(tmpDir, "reports"),
+	}
+	err = o.Run()
+	require.NoError(t, err, "failed to run flaky tests report")
+	assert.FileExists(t, filepath.Join(o.OutDir, flaky.HTMLFileName))
+
+	jsonFile := filepath.Join(o.OutDir, flaky.JSONFileName)
+	data, err := ioutil.ReadFile(jsonFile)
+	require.NoError(t, err, "failed to load file %s", jsonFile)
+
+	// lets check an unchanged report is not written again with a new timestamp
+	time.Sleep(10 * time.Millisecond)
+	err = o.Run()
+	require.NoError(t, err, "failed to run flaky tests report again")
+	data2, err := ioutil.ReadFile(jsonFile)
+	require.NoError(t, err, "failed to load file %s", jsonFile)
+	assert.Equal(t, string(data), string(data2), "the unchanged report should not be written again")
+
+	report, err := flaky.Generate(logDir)
+	require.NoError(t, err, "failed to generate report")
+	require.Len(t, report.Branches, 1, "branches")
+
+	b := report.Branches[0]
+	assert.Equal(t, 4, b.Runs, "runs")
+	require.Len(t, b.Tests, 1, "flaky tests")
+	assert.Equal(t, "TestFlaky", b.Tests[0].Name, "test name")
+	assert.Equal(t, []string{"abc"}, b.Tests[0].Commits, "flaky commits")
+	assert.Equal(t, 2, b.Tests[0].Flips, "flips")
+}
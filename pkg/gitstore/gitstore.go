@@ -2,15 +2,20 @@ package gitstore
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/jenkins-x-plugins/jx-gitops/pkg/cmd/git/setup"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/cmdrunner"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/gitclient"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/gitclient/cli"
+	"github.com/jenkins-x/jx-test-collector/pkg/metrics"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -49,7 +54,7 @@ type Options struct {
 	Username string `env:"GIT_USERNAME"`
 
 	// Email the git user email address to perform commits
-	Email string `env:"GIT_EMAIL,default=jenkins-x@googlegroups.com`
+	Email string `env:"GIT_EMAIL,default=jenkins-x@googlegroups.com"`
 
 	// Token the git token to clone and commit.
 	//
@@ -74,6 +79,41 @@ type Options struct {
 	//
 	// see: https://jenkins-x.io/docs/v3/guides/operator/
 	SecretName string `env:"SECRET_NAME,default=jx-boot"`
+
+	// gitLock serializes the git commands of syncs and evictions as they share the git index
+	gitLock  sync.Mutex
+	lock     sync.Mutex
+	lastSync time.Time
+	evicted  map[string]bool
+}
+
+// SyncResult the result of a successful sync
+type SyncResult struct {
+	// Output a summary of the sync such as "no changes" or "sync completed"
+	Output string `json:"output"`
+
+	// Commit the SHA of the commit pushed by the sync if there were any changes
+	Commit string `json:"commit,omitempty"`
+
+	// FilesAdded the number of files added by the commit
+	FilesAdded int `json:"filesAdded"`
+
+	// FilesChanged the number of files modified by the commit
+	FilesChanged int `json:"filesChanged"`
+
+	// FilesRemoved the number of files removed by the commit
+	FilesRemoved int `json:"filesRemoved"`
+
+	// Bytes the size of the files added or modified by the commit
+	Bytes int64 `json:"bytes"`
+}
+
+// String returns the summary of the sync
+func (r *SyncResult) String() string {
+	if r.Commit == "" {
+		return r.Output
+	}
+	return fmt.Sprintf("%s: commit %s added %d changed %d removed %d files of %d bytes", r.Output, r.Commit, r.FilesAdded, r.FilesChanged, r.FilesRemoved, r.Bytes)
 }
 
 // Validate validates the options and lazily creates any resources required
@@ -214,33 +254,193 @@ func (o *Options) Setup() error {
 }
 
 // Sync performs a synchronisation of any local files to the underlying storage engine
-func (o *Options) Sync() (string, error) {
+func (o *Options) Sync() (*SyncResult, error) {
+	o.gitLock.Lock()
+	defer o.gitLock.Unlock()
+
 	dir := o.Dir
 	g := o.GitClient
-	answer := ""
-	_, err := g.Command(dir, "add", "*")
+	started := time.Now()
+
+	err := o.restoreEvicted()
 	if err != nil {
-		return answer, errors.Wrapf(err, "failed to add files to git")
+		return nil, errors.Wrapf(err, "failed to restore evicted files")
+	}
+
+	_, err = g.Command(dir, "add", "*")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to add files to git")
 	}
 
 	changes, err := gitclient.HasChanges(g, dir)
 	if err != nil {
-		return answer, errors.Wrapf(err, "failed to check if there are changes in git")
+		return nil, errors.Wrapf(err, "failed to check if there are changes in git")
 	}
 
 	if !changes {
-		return "no changes", nil
+		o.setLastSync(started)
+		return &SyncResult{Output: "no changes"}, nil
 	}
 
 	_, err = g.Command(dir, "commit", "-a", "-m", "chore: latest logs")
 	if err != nil {
-		return "", errors.Wrapf(err, "failed to commit latest logs to dir %s", dir)
+		return nil, errors.Wrapf(err, "failed to commit latest logs to dir %s", dir)
+	}
+	answer, err := o.commitResult()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to describe the commit in dir %s", dir)
 	}
 	_, err = g.Command(dir, "push", "origin", o.Branch)
 	if err != nil {
-		return "", errors.Wrapf(err, "failed to push changes to git")
+		metrics.GitPushFailures.Inc()
+		return nil, errors.Wrapf(err, "failed to push changes to git")
 	}
-	return "sync completed", nil
+	o.setLastSync(started)
+	answer.Output = "sync completed"
+	return answer, nil
+}
+
+// commitResult returns the SHA and the files added, changed and removed by the latest commit
+func (o *Options) commitResult() (*SyncResult, error) {
+	dir := o.Dir
+	g := o.GitClient
+	sha, err := g.Command(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get the commit SHA")
+	}
+	answer := &SyncResult{
+		Commit: strings.TrimSpace(sha),
+	}
+
+	text, err := g.Command(dir, "diff-tree", "--no-commit-id", "--name-status", "--no-renames", "-r", "-z", "--root", "HEAD")
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list the files in the commit")
+	}
+	// the output is a NUL separated sequence of status and path pairs
+	fields := strings.Split(strings.Trim(text, "\x00\n"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		status, path := strings.TrimSpace(fields[i]), fields[i+1]
+		switch status {
+		case "A":
+			answer.FilesAdded++
+		case "D":
+			answer.FilesRemoved++
+			continue
+		default:
+			answer.FilesChanged++
+		}
+		info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(path)))
+		if err == nil {
+			answer.Bytes += info.Size()
+		}
+	}
+	return answer, nil
+}
+
+func (o *Options) setLastSync(t time.Time) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.lastSync = t
+}
+
+// Evict removes local files which have been pushed by a previous sync and not modified since
+// to free up disk space. The files are marked as skip-worktree in git so that their removal is not committed.
+//
+// Files are only evicted if they were last modified before the given minimum age and the keep function,
+// if specified, returns false for their path relative to the git clone. Returns the number of bytes freed.
+func (o *Options) Evict(minAge time.Duration, keep func(path string) bool) (int64, error) {
+	o.gitLock.Lock()
+	defer o.gitLock.Unlock()
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	if o.lastSync.IsZero() {
+		return 0, nil
+	}
+	before := o.lastSync
+	oldest := time.Now().Add(-minAge)
+	if oldest.Before(before) {
+		before = oldest
+	}
+
+	dir := o.Dir
+	text, err := o.GitClient.Command(dir, "ls-files", "-z")
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to list the git files in dir %s", dir)
+	}
+	var freed int64
+	var paths []string
+	for _, path := range strings.Split(text, "\x00") {
+		path = strings.TrimSpace(path)
+		if path == "" || o.evicted[path] || (keep != nil && keep(path)) {
+			continue
+		}
+		fileName := filepath.Join(dir, path)
+		info, err := os.Stat(fileName)
+		if err != nil || info.IsDir() || !info.ModTime().Before(before) {
+			continue
+		}
+		err = os.Remove(fileName)
+		if err != nil {
+			return freed, errors.Wrapf(err, "failed to remove file %s", fileName)
+		}
+		freed += info.Size()
+		paths = append(paths, path)
+	}
+
+	if o.evicted == nil {
+		o.evicted = map[string]bool{}
+	}
+	err = o.updateIndex("--skip-worktree", paths)
+	for _, path := range paths {
+		o.evicted[path] = true
+	}
+	if err != nil {
+		return freed, err
+	}
+	if len(paths) > 0 {
+		logrus.WithField("Bytes", freed).Infof("evicted %d synchronised files", len(paths))
+	}
+	return freed, nil
+}
+
+// restoreEvicted clears the skip-worktree flag on evicted files which have been written again
+// so that their changes are committed
+func (o *Options) restoreEvicted() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	var paths []string
+	for path := range o.evicted {
+		if _, err := os.Stat(filepath.Join(o.Dir, path)); err == nil {
+			paths = append(paths, path)
+		}
+	}
+	err := o.updateIndex("--no-skip-worktree", paths)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		delete(o.evicted, path)
+	}
+	return nil
+}
+
+// updateIndex updates the git index flag for the paths in batches to avoid exceeding command line limits
+func (o *Options) updateIndex(flag string, paths []string) error {
+	const batchSize = 100
+	for i := 0; i < len(paths); i += batchSize {
+		j := i + batchSize
+		if j > len(paths) {
+			j = len(paths)
+		}
+		args := append([]string{"update-index", flag, "--"}, paths[i:j]...)
+		_, err := o.GitClient.Command(o.Dir, args...)
+		if err != nil {
+			return errors.Wrapf(err, "failed to update the git index with %s", flag)
+		}
+	}
+	return nil
 }
 
 // GitCloneURL returns the git clone URL
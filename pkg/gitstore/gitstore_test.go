@@ -69,8 +69,8 @@ func TestGitStore(t *testing.T) {
 	err = ioutil.WriteFile(outFile, []byte("Hello\nWorld!\n"), files.DefaultFileWritePermissions)
 	require.NoError(t, err, "failed to save file %s", outFile)
 
-	text, err := o.Sync()
+	result, err := o.Sync()
 	require.NoError(t, err, "failed to run Sync()")
 
-	t.Logf("Sync returned: %s\n", text)
+	t.Logf("Sync returned: %s\n", result.String())
 }
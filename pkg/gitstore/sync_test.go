@@ -0,0 +1,86 @@
+package gitstore_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/gitclient/cli"
+	"github.com/jenkins-x/jx-test-collector/pkg/gitstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncResult(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+	defer os.RemoveAll(tmpDir)
+
+	g := cli.NewCLIClient("git", nil)
+	remoteDir := filepath.Join(tmpDir, "remote.git")
+	dir := filepath.Join(tmpDir, "work")
+	for _, args := range [][]string{
+		{"init", "--bare", remoteDir},
+		{"clone", remoteDir, dir},
+	} {
+		_, err = g.Command(tmpDir, args...)
+		require.NoError(t, err, "failed to run git %v", args)
+	}
+	for _, args := range [][]string{
+		{"config", "user.email", "test@example.com"},
+		{"config", "user.name", "test"},
+		{"checkout", "-b", "gh-pages"},
+	} {
+		_, err = g.Command(dir, args...)
+		require.NoError(t, err, "failed to run git %v", args)
+	}
+
+	o := &gitstore.Options{
+		Dir:       dir,
+		GitClient: g,
+		Branch:    "gh-pages",
+	}
+
+	writeFile(t, dir, "logs/a.log", "hello\n")
+	writeFile(t, dir, "logs/b.log", "world!\n")
+
+	result, err := o.Sync()
+	require.NoError(t, err, "failed to sync")
+	assert.Equal(t, "sync completed", result.Output, "output")
+	assert.Len(t, result.Commit, 40, "commit SHA")
+	assert.Equal(t, 2, result.FilesAdded, "files added")
+	assert.Equal(t, 0, result.FilesChanged, "files changed")
+	assert.Equal(t, 0, result.FilesRemoved, "files removed")
+	assert.Equal(t, int64(13), result.Bytes, "bytes")
+
+	remoteSHA, err := g.Command(remoteDir, "rev-parse", "gh-pages")
+	require.NoError(t, err, "failed to get the pushed commit")
+	assert.Equal(t, result.Commit, remoteSHA, "pushed commit")
+
+	writeFile(t, dir, "logs/a.log", "hello again\n")
+	writeFile(t, dir, "logs/c.log", "new\n")
+	err = os.Remove(filepath.Join(dir, "logs", "b.log"))
+	require.NoError(t, err, "failed to remove file")
+
+	result, err = o.Sync()
+	require.NoError(t, err, "failed to sync")
+	assert.Equal(t, 1, result.FilesAdded, "files added")
+	assert.Equal(t, 1, result.FilesChanged, "files changed")
+	assert.Equal(t, 1, result.FilesRemoved, "files removed")
+	assert.Equal(t, int64(16), result.Bytes, "bytes")
+
+	result, err = o.Sync()
+	require.NoError(t, err, "failed to sync")
+	assert.Equal(t, "no changes", result.Output, "output")
+	assert.Empty(t, result.Commit, "commit")
+}
+
+func writeFile(t *testing.T, dir, path, text string) {
+	fileName := filepath.Join(dir, filepath.FromSlash(path))
+	err := os.MkdirAll(filepath.Dir(fileName), files.DefaultDirWritePermissions)
+	require.NoError(t, err, "failed to create dir for %s", fileName)
+	err = ioutil.WriteFile(fileName, []byte(text), files.DefaultFileWritePermissions)
+	require.NoError(t, err, "failed to save file %s", fileName)
+}
@@ -0,0 +1,53 @@
+package junit
+
+import (
+	"strings"
+)
+
+const (
+	// BeginMarker the line written to a step log before a JUnit XML report
+	BeginMarker = "-----BEGIN JUNIT XML-----"
+
+	// EndMarker the line written to a step log after a JUnit XML report
+	EndMarker = "-----END JUNIT XML-----"
+)
+
+// Extractor extracts the JUnit XML reports delimited by the BeginMarker and EndMarker lines in a log
+type Extractor struct {
+	// OnReport is invoked with the text of each complete report
+	OnReport func(text string)
+
+	buf    strings.Builder
+	inside bool
+}
+
+// Line processes the next line of the log
+func (e *Extractor) Line(line string) {
+	if strings.Contains(line, BeginMarker) {
+		e.buf.Reset()
+		e.inside = true
+		return
+	}
+	if !e.inside {
+		return
+	}
+	if strings.Contains(line, EndMarker) {
+		e.inside = false
+		text := e.buf.String()
+		e.buf.Reset()
+		if e.OnReport != nil && strings.TrimSpace(text) != "" {
+			e.OnReport(text)
+		}
+		return
+	}
+	e.buf.WriteString(line)
+	if !strings.HasSuffix(line, "\n") {
+		e.buf.WriteString("\n")
+	}
+}
+
+// Close discards any incomplete report
+func (e *Extractor) Close() {
+	e.inside = false
+	e.buf.Reset()
+}
@@ -0,0 +1,128 @@
+package junit
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TestSuites the root element of a JUnit XML report containing multiple suites
+type TestSuites struct {
+	XMLName xml.Name    `xml:"testsuites"`
+	Name    string      `xml:"name,attr,omitempty"`
+	Suites  []TestSuite `xml:"testsuite"`
+}
+
+// TestSuite a suite of test cases
+type TestSuite struct {
+	XMLName   xml.Name    `xml:"testsuite"`
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Errors    int         `xml:"errors,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      float64     `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr,omitempty"`
+	Suites    []TestSuite `xml:"testsuite"`
+	Cases     []TestCase  `xml:"testcase"`
+	SystemOut string      `xml:"system-out,omitempty"`
+	SystemErr string      `xml:"system-err,omitempty"`
+}
+
+// TestCase a single test case
+type TestCase struct {
+	Name      string  `xml:"name,attr"`
+	ClassName string  `xml:"classname,attr,omitempty"`
+	Time      float64 `xml:"time,attr"`
+	Failure   *Result `xml:"failure"`
+	Error     *Result `xml:"error"`
+	Skipped   *Result `xml:"skipped"`
+	SystemOut string  `xml:"system-out,omitempty"`
+	SystemErr string  `xml:"system-err,omitempty"`
+}
+
+// Result the failure, error or skipped details of a test case
+type Result struct {
+	Message string `xml:"message,attr,omitempty"`
+	Type    string `xml:"type,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+// Summary the number of tests by status
+type Summary struct {
+	Tests   int `json:"tests"`
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Errors  int `json:"errors"`
+	Skipped int `json:"skipped"`
+}
+
+// Add adds the given summary to this summary
+func (s *Summary) Add(o Summary) {
+	s.Tests += o.Tests
+	s.Passed += o.Passed
+	s.Failed += o.Failed
+	s.Errors += o.Errors
+	s.Skipped += o.Skipped
+}
+
+// IsJUnit returns true if the data looks like a JUnit XML report
+func IsJUnit(data []byte) bool {
+	text := string(bytes.TrimSpace(data))
+	if strings.HasPrefix(text, "<?xml") {
+		return strings.Contains(text, "<testsuite")
+	}
+	return strings.HasPrefix(text, "<testsuite")
+}
+
+// Parse parses a JUnit XML report which can either have a testsuites or testsuite root element
+func Parse(data []byte) (*TestSuites, error) {
+	data = bytes.TrimSpace(data)
+	answer := &TestSuites{}
+	err := xml.Unmarshal(data, answer)
+	if err == nil {
+		return answer, nil
+	}
+
+	suite := TestSuite{}
+	err2 := xml.Unmarshal(data, &suite)
+	if err2 != nil {
+		return nil, errors.Wrapf(err, "failed to parse JUnit XML")
+	}
+	answer.Suites = []TestSuite{suite}
+	return answer, nil
+}
+
+// Summary returns the summary of the test cases in all the suites
+func (s *TestSuites) Summary() Summary {
+	answer := Summary{}
+	for i := range s.Suites {
+		answer.Add(s.Suites[i].Summary())
+	}
+	return answer
+}
+
+// Summary returns the summary of the test cases in the suite and any nested suites
+func (s *TestSuite) Summary() Summary {
+	answer := Summary{}
+	for i := range s.Suites {
+		answer.Add(s.Suites[i].Summary())
+	}
+	for i := range s.Cases {
+		c := &s.Cases[i]
+		answer.Tests++
+		switch {
+		case c.Failure != nil:
+			answer.Failed++
+		case c.Error != nil:
+			answer.Errors++
+		case c.Skipped != nil:
+			answer.Skipped++
+		default:
+			answer.Passed++
+		}
+	}
+	return answer
+}
@@ -0,0 +1,51 @@
+package junit_test
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/junit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractReportsFromLog(t *testing.T) {
+	path := filepath.Join("test_data", "build.log")
+	f, err := os.Open(path)
+	require.NoError(t, err, "failed to open %s", path)
+	defer f.Close()
+
+	var reports []string
+	e := &junit.Extractor{
+		OnReport: func(text string) {
+			reports = append(reports, text)
+		},
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		e.Line(scanner.Text())
+	}
+	e.Close()
+	require.Len(t, reports, 1, "reports found in %s", path)
+
+	data := []byte(reports[0])
+	assert.True(t, junit.IsJUnit(data), "should detect JUnit XML")
+
+	suites, err := junit.Parse(data)
+	require.NoError(t, err, "failed to parse report")
+	require.Len(t, suites.Suites, 1, "suites")
+	assert.Equal(t, junit.Summary{Tests: 4, Passed: 2, Failed: 1, Skipped: 1}, suites.Summary(), "summary")
+}
+
+func TestParseSingleTestSuite(t *testing.T) {
+	data := []byte(`<testsuite name="s"><testcase name="a"/><testcase name="b"><error message="boom"/></testcase></testsuite>`)
+	assert.True(t, junit.IsJUnit(data), "should detect JUnit XML")
+
+	suites, err := junit.Parse(data)
+	require.NoError(t, err, "failed to parse report")
+	assert.Equal(t, junit.Summary{Tests: 2, Passed: 1, Errors: 1}, suites.Summary(), "summary")
+
+	assert.False(t, junit.IsJUnit([]byte(`{"key": "value"}`)), "should not detect JUnit XML")
+}
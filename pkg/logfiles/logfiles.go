@@ -0,0 +1,120 @@
+package logfiles
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+
+	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
+	"github.com/pkg/errors"
+)
+
+const (
+	// GzipExtension the extension added to compressed log files
+	GzipExtension = ".gz"
+
+	// LogExtension the extension of container log files
+	LogExtension = ".log"
+
+	// MetadataFileName the name of the file in the pod log directory containing the pod metadata
+	MetadataFileName = "metadata.json"
+
+	// EventsFileName the name of the file in the pod log directory containing the events
+	EventsFileName = "events.log"
+
+	// CombinedLogFileName the name of the file in the pod and pipeline run directories containing the
+	// interleaved lines of all the containers
+	CombinedLogFileName = "combined.log"
+)
+
+// Compress gzips the file if it is at least the given size, removing the original file.
+// Returns true if the file was compressed
+func Compress(fileName string, minBytes int64) (bool, error) {
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to stat file %s", fileName)
+	}
+	if info.Size() < minBytes {
+		return false, nil
+	}
+
+	in, err := os.Open(fileName)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to open file %s", fileName)
+	}
+	defer in.Close()
+
+	outName := fileName + GzipExtension
+	out, err := os.OpenFile(outName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, files.DefaultFileWritePermissions)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to create file %s", outName)
+	}
+	w := gzip.NewWriter(out)
+	_, err = io.Copy(w, in)
+	if err == nil {
+		err = w.Close()
+	}
+	if err == nil {
+		err = out.Close()
+	} else {
+		out.Close()
+	}
+	if err != nil {
+		os.Remove(outName)
+		return false, errors.Wrapf(err, "failed to compress file %s", fileName)
+	}
+
+	in.Close()
+	err = os.Remove(fileName)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to remove file %s", fileName)
+	}
+	return true, nil
+}
+
+// Open opens the log file for reading, transparently decompressing it if only the compressed file exists
+func Open(fileName string) (io.ReadCloser, error) {
+	f, err := os.Open(fileName)
+	if err == nil {
+		return f, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	gz, err2 := os.Open(fileName + GzipExtension)
+	if err2 != nil {
+		return nil, err
+	}
+	r, err := gzip.NewReader(gz)
+	if err != nil {
+		gz.Close()
+		return nil, errors.Wrapf(err, "failed to read compressed file %s%s", fileName, GzipExtension)
+	}
+	return &gzipReadCloser{Reader: r, file: gz}, nil
+}
+
+// Exists returns true if the log file or its compressed file exists
+func Exists(fileName string) bool {
+	for _, name := range []string{fileName, fileName + GzipExtension} {
+		if _, err := os.Stat(name); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+type gzipReadCloser struct {
+	*gzip.Reader
+	file *os.File
+}
+
+// Close closes the reader and underlying file
+func (r *gzipReadCloser) Close() error {
+	err := r.Reader.Close()
+	err2 := r.file.Close()
+	if err != nil {
+		return err
+	}
+	return err2
+}
@@ -0,0 +1,50 @@
+package logfiles_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
+	"github.com/jenkins-x/jx-test-collector/pkg/logfiles"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressAndOpen(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	text := strings.Repeat("Hello World!\n", 100)
+	small := filepath.Join(tmpDir, "small.log")
+	large := filepath.Join(tmpDir, "large.log")
+	for _, f := range []string{small, large} {
+		err = ioutil.WriteFile(f, []byte(text), files.DefaultFileWritePermissions)
+		require.NoError(t, err, "failed to save file %s", f)
+	}
+
+	compressed, err := logfiles.Compress(small, int64(len(text)+1))
+	require.NoError(t, err, "failed to compress %s", small)
+	assert.False(t, compressed, "should not compress %s", small)
+	assert.FileExists(t, small)
+
+	compressed, err = logfiles.Compress(large, 1)
+	require.NoError(t, err, "failed to compress %s", large)
+	assert.True(t, compressed, "should compress %s", large)
+	assert.NoFileExists(t, large)
+	assert.FileExists(t, large+logfiles.GzipExtension)
+	assert.True(t, logfiles.Exists(large), "compressed log should exist")
+
+	for _, f := range []string{small, large} {
+		r, err := logfiles.Open(f)
+		require.NoError(t, err, "failed to open %s", f)
+		data, err := ioutil.ReadAll(r)
+		require.NoError(t, err, "failed to read %s", f)
+		r.Close()
+		assert.Equal(t, text, string(data), "contents of %s", f)
+	}
+
+	_, err = logfiles.Open(filepath.Join(tmpDir, "missing.log"))
+	require.Error(t, err, "should fail to open a missing file")
+}
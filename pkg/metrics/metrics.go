@@ -0,0 +1,113 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// Path the URL path the metrics are served on
+	Path = "/metrics"
+
+	namespace = "jx_test_collector"
+
+	// ResultSuccess the sync outcome label value of a successful sync
+	ResultSuccess = "success"
+
+	// ResultFailure the sync outcome label value of a failed sync
+	ResultFailure = "failure"
+)
+
+var (
+	// ActiveTails the number of container logs currently being tailed
+	ActiveTails = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_tails",
+		Help:      "The number of container logs currently being tailed",
+	})
+
+	// LinesWritten the number of log lines written per namespace
+	LinesWritten = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "log_lines_total",
+		Help:      "The number of log lines written",
+	}, []string{"namespace"})
+
+	// BytesWritten the number of log bytes written per namespace before any truncation or compression
+	BytesWritten = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "log_bytes_total",
+		Help:      "The number of log bytes written before any truncation or compression",
+	}, []string{"namespace"})
+
+	// MaskedLines the number of log lines which had secret values masked
+	MaskedLines = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "masked_lines_total",
+		Help:      "The number of log lines which had secret values masked",
+	})
+
+	// WatchReconnects the number of times a watch was reconnected after it closed
+	WatchReconnects = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "watch_reconnects_total",
+		Help:      "The number of times a pod, event or PipelineActivity watch was reconnected after it closed",
+	})
+
+	// ResourceListErrors the number of failures listing resources per group, version and resource
+	ResourceListErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "resource_list_errors_total",
+		Help:      "The number of failures listing kubernetes resources",
+	}, []string{"group", "version", "resource"})
+
+	// SyncDuration the duration of syncs to the git store
+	SyncDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sync_duration_seconds",
+		Help:      "The duration of syncs to the git store",
+		Buckets:   []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	})
+
+	// Syncs the number of syncs by result
+	Syncs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "syncs_total",
+		Help:      "The number of syncs to the git store by result",
+	}, []string{"result"})
+
+	// GitPushFailures the number of failed git pushes
+	GitPushFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "git_push_failures_total",
+		Help:      "The number of failed git pushes",
+	})
+)
+
+// Handler returns the handler serving the metrics in the prometheus text format
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ResourceListError records a failure to list the given resource
+func ResourceListError(r schema.GroupVersionResource) {
+	group := r.Group
+	if group == "" {
+		group = "core"
+	}
+	ResourceListErrors.WithLabelValues(group, r.Version, r.Resource).Inc()
+}
+
+// SyncResult records the duration and outcome of a sync
+func SyncResult(seconds float64, err error) {
+	SyncDuration.Observe(seconds)
+	if err != nil {
+		Syncs.WithLabelValues(ResultFailure).Inc()
+		return
+	}
+	Syncs.WithLabelValues(ResultSuccess).Inc()
+}
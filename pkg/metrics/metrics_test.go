@@ -0,0 +1,46 @@
+package metrics_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/metrics"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics.ActiveTails.Inc()
+	metrics.LinesWritten.WithLabelValues("jx").Add(3)
+	metrics.ResourceListError(schema.GroupVersionResource{Version: "v1", Resource: "events"})
+	metrics.SyncResult(1.5, nil)
+	metrics.SyncResult(0.5, errors.Errorf("failed"))
+
+	server := httptest.NewServer(metrics.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + metrics.Path)
+	require.NoError(t, err, "failed to get metrics")
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err, "failed to read metrics")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	text := string(data)
+	for _, expected := range []string{
+		"jx_test_collector_active_tails 1",
+		`jx_test_collector_log_lines_total{namespace="jx"} 3`,
+		`jx_test_collector_resource_list_errors_total{group="core",resource="events",version="v1"} 1`,
+		`jx_test_collector_syncs_total{result="success"} 1`,
+		`jx_test_collector_syncs_total{result="failure"} 1`,
+		"jx_test_collector_sync_duration_seconds_count 2",
+		"jx_test_collector_watch_reconnects_total 0",
+		"jx_test_collector_git_push_failures_total 0",
+	} {
+		assert.Contains(t, text, expected)
+	}
+}
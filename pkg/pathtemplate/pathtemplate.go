@@ -0,0 +1,144 @@
+package pathtemplate
+
+import (
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// appPathTemplate the namespace and app directories shared by the default pod and run templates
+	// where the app is derived from the app labels and, for tekton pods, the owner, repository and branch
+	appPathTemplate = `{{ .Namespace }}/
+{{- $app := or (index .Labels "app") (index .Labels "app.kubernetes.io/managed-by") }}
+{{- with $app }}{{ . }}/{{ end }}
+{{- if eq $app "tekton-pipelines" }}
+{{- with index .Labels "owner" }}{{ . }}/{{ end }}
+{{- with index .Labels "repository" }}{{ . }}/{{ end }}
+{{- with index .Labels "branch" }}{{ . }}/{{ end }}
+{{- end }}`
+
+	// DefaultPodPathTemplate the default template for the pod directory which uses namespace/app/pod
+	DefaultPodPathTemplate = appPathTemplate + `
+{{- .Name }}`
+
+	// DefaultRunPathTemplate the default template for the pipeline run directory which is the same as
+	// the pod directory but uses the name of the tekton pipeline run instead of the pod
+	DefaultRunPathTemplate = appPathTemplate + `
+{{- or (index .Labels "tekton.dev/pipelineRun") .Name }}`
+)
+
+// separatorReplacer replaces the path separators in label and annotation values
+var separatorReplacer = strings.NewReplacer("/", "_", "\\", "_")
+
+// Data the data a path template is evaluated against
+type Data struct {
+	Group           string
+	Version         string
+	Resource        string
+	Kind            string
+	Name            string
+	Namespace       string
+	Labels          map[string]string
+	Annotations     map[string]string
+	OwnerReferences []metav1.OwnerReference
+}
+
+// Template a go template which generates a relative file path
+type Template struct {
+	Text string
+	tmpl *template.Template
+}
+
+// NewData creates the template data for the given object.
+//
+// Path separators in label and annotation values are replaced so that a value is always a single path segment
+func NewData(obj metav1.Object) *Data {
+	return &Data{
+		Name:            obj.GetName(),
+		Namespace:       obj.GetNamespace(),
+		Labels:          sanitizeValues(obj.GetLabels()),
+		Annotations:     sanitizeValues(obj.GetAnnotations()),
+		OwnerReferences: obj.GetOwnerReferences(),
+	}
+}
+
+func sanitizeValues(values map[string]string) map[string]string {
+	answer := map[string]string{}
+	for k, v := range values {
+		answer[k] = separatorReplacer.Replace(v)
+	}
+	return answer
+}
+
+// NewResourceData creates the template data for the given resource
+func NewResourceData(r schema.GroupVersionResource, kind string, obj metav1.Object) *Data {
+	data := NewData(obj)
+	data.Group = r.Group
+	data.Version = r.Version
+	data.Resource = r.Resource
+	data.Kind = kind
+	return data
+}
+
+// Parse parses the path template
+func Parse(name, text string) (*Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse path template %s", name)
+	}
+	return &Template{
+		Text: text,
+		tmpl: tmpl,
+	}, nil
+}
+
+// MustParse parses the path template or panics
+func MustParse(name, text string) *Template {
+	t, err := Parse(name, text)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Path evaluates the template returning a cleaned relative path ignoring any empty path segments.
+//
+// An error is returned if the path is empty or contains a .. segment
+func (t *Template) Path(data *Data) (string, error) {
+	buf := strings.Builder{}
+	err := t.tmpl.Execute(&buf, data)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to evaluate path template %s", t.tmpl.Name())
+	}
+	// lets ignore empty path segments which are usually caused by missing labels
+	var segments []string
+	for _, s := range strings.Split(filepath.ToSlash(strings.TrimSpace(buf.String())), "/") {
+		s = strings.TrimSpace(s)
+		if s == ".." {
+			return "", errors.Errorf("path template %s generated path %s containing .. for %s", t.tmpl.Name(), buf.String(), data.Name)
+		}
+		if s != "" && s != "." {
+			segments = append(segments, s)
+		}
+	}
+	if len(segments) == 0 {
+		return "", errors.Errorf("path template %s generated an empty path for %s", t.tmpl.Name(), data.Name)
+	}
+	return filepath.Join(segments...), nil
+}
+
+// Validate evaluates the template against the sample data to check it generates valid paths
+func (t *Template) Validate(samples ...*Data) error {
+	for _, data := range samples {
+		_, err := t.Path(data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
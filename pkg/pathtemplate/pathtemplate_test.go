@@ -0,0 +1,128 @@
+package pathtemplate_test
+
+import (
+	"testing"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/pathtemplate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, text := range []string{"{{ .Name", "{{ .Name }", "{{ end }}", "{{ nosuchfunc .Name }}"} {
+		_, err := pathtemplate.Parse("test", text)
+		require.Error(t, err, "should fail to parse template %s", text)
+		t.Logf("got expected error for template %s: %s\n", text, err.Error())
+	}
+
+	assert.Panics(t, func() {
+		pathtemplate.MustParse("test", "{{ .Name")
+	})
+}
+
+func TestDefaultTemplates(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myorg-myrepo-pr-1-2-from-build-pack-pod-abc",
+			Namespace: "jx",
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": "tekton-pipelines",
+				"owner":                        "myorg",
+				"repository":                   "myrepo",
+				"branch":                       "PR-1",
+				"tekton.dev/pipelineRun":       "myorg-myrepo-pr-1-2",
+			},
+		},
+	}
+	data := pathtemplate.NewData(pod)
+
+	path, err := pathtemplate.MustParse("pod", pathtemplate.DefaultPodPathTemplate).Path(data)
+	require.NoError(t, err, "failed to evaluate pod template")
+	assert.Equal(t, "jx/tekton-pipelines/myorg/myrepo/PR-1/myorg-myrepo-pr-1-2-from-build-pack-pod-abc", path, "pod path")
+
+	path, err = pathtemplate.MustParse("run", pathtemplate.DefaultRunPathTemplate).Path(data)
+	require.NoError(t, err, "failed to evaluate run template")
+	assert.Equal(t, "jx/tekton-pipelines/myorg/myrepo/PR-1/myorg-myrepo-pr-1-2", path, "run path")
+}
+
+func TestMissingLabels(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mypod",
+			Namespace: "jx",
+		},
+	}
+	data := pathtemplate.NewData(pod)
+
+	tmpl := pathtemplate.MustParse("test", `{{ .Namespace }}/{{ index .Labels "team" }}/{{ index .Annotations "release" }}/{{ .Name }}`)
+	path, err := tmpl.Path(data)
+	require.NoError(t, err, "failed to evaluate template")
+	assert.Equal(t, "jx/mypod", path, "the empty segments of missing labels should be ignored")
+
+	path, err = pathtemplate.MustParse("pod", pathtemplate.DefaultPodPathTemplate).Path(data)
+	require.NoError(t, err, "failed to evaluate pod template")
+	assert.Equal(t, "jx/mypod", path, "pod path")
+
+	_, err = pathtemplate.MustParse("test", `{{ index .Labels "team" }}`).Path(data)
+	require.Error(t, err, "should fail for an empty path")
+	t.Logf("got expected error for an empty path: %s\n", err.Error())
+}
+
+func TestSanitizePath(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mypod",
+			Namespace: "jx",
+			Labels: map[string]string{
+				"parent": "..",
+			},
+			Annotations: map[string]string{
+				"release":  "v1/../../etc",
+				"windows":  `a\b`,
+				"relative": "./cheese",
+			},
+		},
+	}
+	data := pathtemplate.NewData(pod)
+	assert.Equal(t, "v1/../../etc", pod.Annotations["release"], "the pod should not be modified")
+
+	testCases := []struct {
+		text     string
+		expected string
+	}{
+		{`{{ .Namespace }}/{{ index .Annotations "release" }}/{{ .Name }}`, "jx/v1_.._.._etc/mypod"},
+		{`{{ .Namespace }}/{{ index .Annotations "windows" }}/{{ .Name }}`, `jx/a_b/mypod`},
+		{`{{ .Namespace }}/{{ index .Annotations "relative" }}/{{ .Name }}`, "jx/._cheese/mypod"},
+		{`./{{ .Namespace }}//{{ .Name }}/`, "jx/mypod"},
+		{`{{ .Namespace }}/{{ index .Labels "parent" }}/{{ .Name }}`, ""},
+		{`../{{ .Name }}`, ""},
+		{`{{ .Namespace }}/../../{{ .Name }}`, ""},
+		{`{{ .Namespace }}/..`, ""},
+	}
+	for _, tc := range testCases {
+		path, err := pathtemplate.MustParse("test", tc.text).Path(data)
+		if tc.expected == "" {
+			require.Error(t, err, "should fail for template %s", tc.text)
+			t.Logf("got expected error for template %s: %s\n", tc.text, err.Error())
+			continue
+		}
+		require.NoError(t, err, "failed to evaluate template %s", tc.text)
+		assert.Equal(t, tc.expected, path, "path for template %s", tc.text)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	samples := []*pathtemplate.Data{
+		pathtemplate.NewResourceData(schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}, "ConfigMap", &metav1.ObjectMeta{Name: "mycm", Namespace: "jx"}),
+		pathtemplate.NewResourceData(schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"}, "ClusterRole", &metav1.ObjectMeta{Name: "myrole"}),
+	}
+
+	err := pathtemplate.MustParse("resource", "{{ .Group }}/{{ .Version }}/{{ .Resource }}/{{ with .Namespace }}{{ . }}/{{ end }}{{ .Name }}.yaml").Validate(samples...)
+	assert.NoError(t, err, "should be valid")
+
+	err = pathtemplate.MustParse("resource", "{{ .Namespace }}").Validate(samples...)
+	assert.Error(t, err, "should fail for a cluster scoped resource")
+}
@@ -6,13 +6,17 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/kube"
+	"github.com/jenkins-x/jx-test-collector/pkg/metrics"
+	"github.com/jenkins-x/jx-test-collector/pkg/pathtemplate"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 	"sigs.k8s.io/yaml"
@@ -28,10 +32,29 @@ type Options struct {
 	// Namespace the namespace to query resources from
 	Namespace string
 
+	// PathTemplate the go template evaluated against each resource to create the path of its YAML file.
+	// The template can use the Group, Version, Resource, Kind, Name, Namespace, Labels, Annotations
+	// and OwnerReferences of the resource.
+	//
+	// Defaults to DefaultPathTemplate
+	PathTemplate string `env:"RESOURCE_PATH_TEMPLATE"`
+
 	// DynamicClient the client to access kubernetes resources
 	DynamicClient dynamic.Interface
+
+	pathTemplate *pathtemplate.Template
+	lock         sync.Mutex
+	paths        map[string]string
+
+	// OnResource if specified is invoked with each resource and its YAML after it has been saved
+	OnResource func(r schema.GroupVersionResource, resource *unstructured.Unstructured, data []byte) error
 }
 
+const (
+	// DefaultPathTemplate the default template for resource files which uses group/version/resource/namespace/name.yaml
+	DefaultPathTemplate = "{{ .Group }}/{{ .Version }}/{{ .Resource }}/{{ with .Namespace }}{{ . }}/{{ end }}{{ .Name }}.yaml"
+)
+
 var (
 	// ResourceGVRs the resources
 	ResourceGVRs = []schema.GroupVersionResource{
@@ -62,6 +85,26 @@ func init() {
 func (o *Options) Validate(dir string) error {
 	o.Dir = dir
 	var err error
+	if o.pathTemplate == nil {
+		if o.PathTemplate == "" {
+			o.PathTemplate = DefaultPathTemplate
+		}
+		o.pathTemplate, err = pathtemplate.Parse("resource", o.PathTemplate)
+		if err != nil {
+			return errors.Wrapf(err, "invalid resource path template")
+		}
+		err = o.pathTemplate.Validate(&pathtemplate.Data{
+			Group:     "core",
+			Version:   "v1",
+			Resource:  "pods",
+			Kind:      "Pod",
+			Name:      "myapp-5d8b9c7f4-x2x9z",
+			Namespace: "jx",
+		})
+		if err != nil {
+			return errors.Wrapf(err, "invalid resource path template")
+		}
+	}
 	o.DynamicClient, err = kube.LazyCreateDynamicClient(o.DynamicClient)
 	if err != nil {
 		return errors.Wrapf(err, "failed to create kubernetes dynamic client")
@@ -79,6 +122,12 @@ func (o *Options) Run() error {
 	dynClient := o.DynamicClient
 	ns := o.Namespace
 
+	// lets rebuild the paths of the resources so that deleted resources are forgotten, keeping the paths of
+	// any resources which could not be listed
+	paths := map[string]string{}
+	listed := map[string]bool{}
+	defer o.setPaths(paths, listed)
+
 	ctx := o.GetContext()
 	for _, r := range ResourceGVRs {
 		log := logrus.WithFields(map[string]interface{}{
@@ -90,11 +139,13 @@ func (o *Options) Run() error {
 		if err != nil && !apierrors.IsNotFound(err) {
 			// probably RBAC related
 			log.WithError(err).Error("cannot list resources")
+			metrics.ResourceListError(r)
 			continue
 		}
 		if resources == nil {
 			continue
 		}
+		listed[resourceKey(r)] = true
 		for i := range resources.Items {
 			resource := &resources.Items[i]
 			if r.Group == "" {
@@ -103,19 +154,19 @@ func (o *Options) Run() error {
 			if r.Version == "" {
 				r.Version = "v1"
 			}
-			dir := filepath.Join(o.Dir, r.Group, r.Version, r.Resource)
-			ns := resource.GetNamespace()
-			name := resource.GetName()
-
-			if ns != "" {
-				dir = filepath.Join(dir, ns)
+			path, err := o.pathTemplate.Path(pathtemplate.NewResourceData(r, resource.GetKind(), resource))
+			if err != nil {
+				log.WithError(err).Error("cannot create path for resource")
+				continue
 			}
-			err := os.MkdirAll(dir, files.DefaultDirWritePermissions)
+			fileName := filepath.Join(o.Dir, path)
+			paths[pathKey(r, resource.GetNamespace(), resource.GetName())] = path
+			dir := filepath.Dir(fileName)
+			err = os.MkdirAll(dir, files.DefaultDirWritePermissions)
 			if err != nil {
 				return errors.Wrapf(err, "failed to create directory %s", dir)
 			}
 
-			fileName := filepath.Join(dir, name+".yaml")
 			data, err := yaml.Marshal(resource)
 			if err != nil {
 				return errors.Wrapf(err, "failed to marshal resource to YAML for file %s", fileName)
@@ -125,7 +176,71 @@ func (o *Options) Run() error {
 			if err != nil {
 				return errors.Wrapf(err, "failed to save file %s", fileName)
 			}
+
+			if o.OnResource != nil {
+				err = o.OnResource(r, resource, data)
+				if err != nil {
+					return errors.Wrapf(err, "failed to process resource %s", fileName)
+				}
+			}
 		}
 	}
 	return nil
 }
+
+// FileName returns the file name of the YAML of the resource with the given name.
+//
+// Resources saved by this process are looked up by name. Otherwise the path template is
+// evaluated using the resource and name which requires a template that does not use labels or annotations
+func (o *Options) FileName(r schema.GroupVersionResource, namespace, name string) (string, error) {
+	if r.Group == "" {
+		r.Group = "core"
+	}
+	o.lock.Lock()
+	path := o.paths[pathKey(r, namespace, name)]
+	o.lock.Unlock()
+	if path != "" {
+		return filepath.Join(o.Dir, path), nil
+	}
+
+	t := o.pathTemplate
+	if t == nil {
+		t = pathtemplate.MustParse("resource", DefaultPathTemplate)
+	}
+	obj := &metav1.ObjectMeta{Name: name, Namespace: namespace}
+	path, err := t.Path(pathtemplate.NewResourceData(r, "", obj))
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to create path for resource %s", name)
+	}
+	return filepath.Join(o.Dir, path), nil
+}
+
+// setPaths replaces the paths of the saved resources keeping the previous paths of the resources
+// which were not listed
+func (o *Options) setPaths(paths map[string]string, listed map[string]bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	for k, path := range o.paths {
+		if _, ok := paths[k]; ok {
+			continue
+		}
+		idx := strings.LastIndex(k, "/")
+		idx = strings.LastIndex(k[:idx], "/")
+		if !listed[k[:idx]] {
+			paths[k] = path
+		}
+	}
+	o.paths = paths
+}
+
+func pathKey(r schema.GroupVersionResource, namespace, name string) string {
+	return strings.Join([]string{resourceKey(r), namespace, name}, "/")
+}
+
+func resourceKey(r schema.GroupVersionResource) string {
+	if r.Group == "" {
+		r.Group = "core"
+	}
+	return strings.Join([]string{r.Group, r.Version, r.Resource}, "/")
+}
@@ -9,10 +9,13 @@ import (
 
 	"github.com/ghodss/yaml"
 	"github.com/jenkins-x/jx-test-collector/pkg/resources"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic/fake"
 )
 
@@ -35,6 +38,43 @@ func TestResources(t *testing.T) {
 	require.NoError(t, err, "failed to run Run()")
 }
 
+func TestResourceFileNames(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	pod := &unstructured.Unstructured{}
+	pod.SetAPIVersion("v1")
+	pod.SetKind("Pod")
+	pod.SetNamespace("jx")
+	pod.SetName("mypod")
+	pod.SetLabels(map[string]string{"app": "myapp"})
+
+	o := &resources.Options{
+		PathTemplate: `{{ .Namespace }}/{{ index .Labels "app" }}/{{ .Name }}.yaml`,
+	}
+	o.Dir = tmpDir
+	o.Ctx = context.TODO()
+	o.DynamicClient = fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), resources.ResourceMap, pod)
+
+	err = o.Run()
+	require.NoError(t, err, "failed to run Run()")
+
+	fileName, err := o.FileName(pods, "jx", "mypod")
+	require.NoError(t, err, "failed to get file name")
+	assert.Equal(t, filepath.Join(tmpDir, "jx", "myapp", "mypod.yaml"), fileName, "the path of a saved resource should be remembered")
+	assert.FileExists(t, fileName)
+
+	err = o.DynamicClient.Resource(pods).Namespace("jx").Delete(o.Ctx, "mypod", metav1.DeleteOptions{})
+	require.NoError(t, err, "failed to delete pod")
+	err = o.Run()
+	require.NoError(t, err, "failed to run Run()")
+
+	fileName, err = o.FileName(pods, "jx", "mypod")
+	require.NoError(t, err, "failed to get file name")
+	assert.Equal(t, filepath.Join(tmpDir, "jx", "mypod.yaml"), fileName, "the path of a deleted resource should be forgotten")
+}
+
 // LoadTestResources loads the test resources
 func LoadTestResources(t *testing.T, dir string) []runtime.Object {
 	files, err := ioutil.ReadDir(dir)
@@ -0,0 +1,183 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	// DefaultMaxLines the default maximum number of lines kept in the index
+	DefaultMaxLines = 200000
+
+	// DefaultLimit the default maximum number of results returned by a search
+	DefaultLimit = 100
+)
+
+// Context the container a line was written by
+type Context struct {
+	Namespace   string `json:"namespace"`
+	Pod         string `json:"pod"`
+	Container   string `json:"container"`
+	PipelineRun string `json:"pipelineRun,omitempty"`
+	Task        string `json:"task,omitempty"`
+
+	// LogFile the file name of the container log relative to the work directory
+	LogFile string `json:"logFile"`
+}
+
+// Result a line matching a search
+type Result struct {
+	*Context
+
+	// Line the line number within the log file starting at 1
+	Line      int       `json:"line"`
+	Text      string    `json:"text"`
+	Timestamp time.Time `json:"timestamp,omitempty"`
+}
+
+// Index an in memory inverted index of the most recent log lines.
+//
+// Lines are identified by increasing IDs so that the postings of each token are sorted
+// and the oldest lines can be evicted by trimming the start of the postings
+type Index struct {
+	// MaxLines the maximum number of lines kept. Defaults to DefaultMaxLines
+	MaxLines int
+
+	lock     sync.RWMutex
+	entries  []*Result
+	firstID  int
+	postings map[string][]int
+	evicted  int
+}
+
+// Add adds a line to the index
+func (x *Index) Add(ctx *Context, line int, text string, timestamp time.Time) {
+	tokens := Tokenize(text)
+	if len(tokens) == 0 {
+		return
+	}
+
+	x.lock.Lock()
+	defer x.lock.Unlock()
+
+	if x.postings == nil {
+		x.postings = map[string][]int{}
+	}
+	id := x.firstID + len(x.entries)
+	x.entries = append(x.entries, &Result{
+		Context:   ctx,
+		Line:      line,
+		Text:      text,
+		Timestamp: timestamp,
+	})
+	seen := map[string]bool{}
+	for _, token := range tokens {
+		if seen[token] {
+			continue
+		}
+		seen[token] = true
+		x.postings[token] = append(x.postings[token], id)
+	}
+
+	maxLines := x.MaxLines
+	if maxLines <= 0 {
+		maxLines = DefaultMaxLines
+	}
+	if len(x.entries) > maxLines {
+		n := len(x.entries) - maxLines
+		x.entries = append(x.entries[:0:0], x.entries[n:]...)
+		x.firstID += n
+		x.evicted += n
+		if x.evicted >= maxLines {
+			x.compact()
+		}
+	}
+}
+
+// compact removes the evicted lines from the postings
+func (x *Index) compact() {
+	for token, ids := range x.postings {
+		ids = trimEvicted(ids, x.firstID)
+		if len(ids) == 0 {
+			delete(x.postings, token)
+			continue
+		}
+		x.postings[token] = append(ids[:0:0], ids...)
+	}
+	x.evicted = 0
+}
+
+// Search returns the most recent lines containing all of the tokens in the query and, if the query
+// contains multiple tokens, the query text itself ignoring case. The filter if specified restricts the results
+func (x *Index) Search(query string, limit int, filter func(*Context) bool) []*Result {
+	tokens := Tokenize(query)
+	if len(tokens) == 0 {
+		return nil
+	}
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+	phrase := ""
+	if len(tokens) > 1 {
+		phrase = strings.ToLower(strings.TrimSpace(query))
+	}
+
+	x.lock.RLock()
+	defer x.lock.RUnlock()
+
+	// lets intersect the postings starting with the rarest token
+	var lists [][]int
+	for _, token := range tokens {
+		ids := trimEvicted(x.postings[token], x.firstID)
+		if len(ids) == 0 {
+			return nil
+		}
+		lists = append(lists, ids)
+	}
+	sort.Slice(lists, func(i, j int) bool {
+		return len(lists[i]) < len(lists[j])
+	})
+
+	var answer []*Result
+	candidates := lists[0]
+	for i := len(candidates) - 1; i >= 0 && len(answer) < limit; i-- {
+		id := candidates[i]
+		if !containsAll(lists[1:], id) {
+			continue
+		}
+		r := x.entries[id-x.firstID]
+		if phrase != "" && !strings.Contains(strings.ToLower(r.Text), phrase) {
+			continue
+		}
+		if filter != nil && !filter(r.Context) {
+			continue
+		}
+		answer = append(answer, r)
+	}
+	return answer
+}
+
+// Tokenize splits the text into lower case tokens of letters and digits
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func trimEvicted(ids []int, firstID int) []int {
+	idx := sort.SearchInts(ids, firstID)
+	return ids[idx:]
+}
+
+func containsAll(lists [][]int, id int) bool {
+	for _, ids := range lists {
+		idx := sort.SearchInts(ids, id)
+		if idx >= len(ids) || ids[idx] != id {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package search_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/search"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearch(t *testing.T) {
+	build := &search.Context{Namespace: "jx", Pod: "mypod", Container: "step-build", LogFile: "logs/jx/mypod/step-build.log"}
+	test := &search.Context{Namespace: "jx", Pod: "mypod", Container: "step-test", LogFile: "logs/jx/mypod/step-test.log"}
+
+	x := &search.Index{}
+	now := time.Now()
+	x.Add(build, 1, "compiling main.go", now)
+	x.Add(build, 2, "main.go:12: undefined: foo", now)
+	x.Add(test, 1, "--- FAIL: TestFoo (0.01s)", now)
+	x.Add(test, 2, "panic: runtime error: index out of range", now)
+	x.Add(test, 3, "FAIL github.com/myorg/myrepo 0.012s", now)
+
+	testCases := []struct {
+		query    string
+		filter   func(*search.Context) bool
+		expected []string
+	}{
+		{
+			query:    "fail",
+			expected: []string{"step-test:3", "step-test:1"},
+		},
+		{
+			query:    "MAIN.GO",
+			expected: []string{"step-build:2", "step-build:1"},
+		},
+		{
+			query:    "runtime error",
+			expected: []string{"step-test:2"},
+		},
+		{
+			query: "error runtime",
+		},
+		{
+			query: "does-not-exist",
+		},
+		{
+			query: "main",
+			filter: func(c *search.Context) bool {
+				return c.Container == "step-test"
+			},
+		},
+	}
+	for _, tc := range testCases {
+		var actual []string
+		for _, r := range x.Search(tc.query, 0, tc.filter) {
+			actual = append(actual, fmt.Sprintf("%s:%d", r.Container, r.Line))
+		}
+		assert.Equal(t, tc.expected, actual, "results for %s", tc.query)
+	}
+
+	results := x.Search("fail", 1, nil)
+	require.Len(t, results, 1, "limited results")
+	assert.Equal(t, "logs/jx/mypod/step-test.log", results[0].LogFile, "log file")
+}
+
+func TestSearchEviction(t *testing.T) {
+	ctx := &search.Context{Namespace: "jx", Pod: "mypod", Container: "step-test"}
+	x := &search.Index{MaxLines: 10}
+	for i := 1; i <= 35; i++ {
+		x.Add(ctx, i, fmt.Sprintf("line %d of the log", i), time.Time{})
+	}
+
+	results := x.Search("line", 100, nil)
+	require.Len(t, results, 10, "results should only include the most recent lines")
+	assert.Equal(t, 35, results[0].Line, "most recent line")
+	assert.Equal(t, 26, results[9].Line, "oldest line")
+
+	assert.Empty(t, x.Search("5", 100, nil), "line 5 should be evicted")
+	assert.Len(t, x.Search("35", 100, nil), 1, "line 35 should be found")
+}
@@ -0,0 +1,66 @@
+package tailer
+
+import (
+	"path/filepath"
+	"sync"
+)
+
+// ActivePods tracks the directories of the pods whose containers are being tailed so that their
+// files are not evicted. The directories are keyed by the target ID so that they are released when
+// the containers are removed
+type ActivePods struct {
+	lock sync.Mutex
+	dirs map[string]string
+	refs map[string]int
+}
+
+// Add marks the directory of the target's pod as active
+func (a *ActivePods) Add(t *Target, dir string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	id := t.GetID()
+	if _, ok := a.dirs[id]; ok {
+		return
+	}
+	if a.dirs == nil {
+		a.dirs = map[string]string{}
+		a.refs = map[string]int{}
+	}
+	dir = filepath.Clean(dir)
+	a.dirs[id] = dir
+	a.refs[dir]++
+}
+
+// Remove releases the directory of the target's pod once none of its containers are active
+func (a *ActivePods) Remove(t *Target) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	id := t.GetID()
+	dir, ok := a.dirs[id]
+	if !ok {
+		return
+	}
+	delete(a.dirs, id)
+	a.refs[dir]--
+	if a.refs[dir] <= 0 {
+		delete(a.refs, dir)
+	}
+}
+
+// Active returns true if the file with the slash separated path is in the directory of an active pod
+func (a *ActivePods) Active(path string) bool {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.refs[filepath.Dir(filepath.FromSlash(path))] > 0
+}
+
+// Len returns the number of active containers
+func (a *ActivePods) Len() int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return len(a.dirs)
+}
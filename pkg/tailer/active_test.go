@@ -0,0 +1,72 @@
+package tailer_test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/masker"
+	"github.com/jenkins-x/jx-test-collector/pkg/tailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestActivePods(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	kubeClient := fake.NewSimpleClientset()
+	o := &tailer.Options{
+		Dir:     tmpDir,
+		LogPath: "logs",
+		Masker:  &masker.Client{},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pods := kubeClient.CoreV1().Pods("jx")
+	added, removed, err := o.Watch(ctx, pods, labels.Everything())
+	require.NoError(t, err, "failed to watch pods")
+
+	active := &tailer.ActivePods{}
+	pod := newMetadataPod()
+	_, err = pods.Create(ctx, pod, metav1.CreateOptions{})
+	require.NoError(t, err, "failed to create pod")
+
+	var targets []*tailer.Target
+	for len(targets) < 3 {
+		select {
+		case p := <-added:
+			targets = append(targets, p)
+			active.Add(p, filepath.Join(o.LogPath, p.Path))
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "timed out waiting for the added targets")
+		}
+	}
+	fileName := "logs/" + targets[0].Path + "/step-build.log"
+	assert.True(t, active.Active(fileName), "the log of a tailed pod should not be evicted")
+	assert.False(t, active.Active("logs/jx/myapp/other/step-build.log"), "the log of another pod can be evicted")
+
+	err = pods.Delete(ctx, pod.Name, metav1.DeleteOptions{})
+	require.NoError(t, err, "failed to delete pod")
+
+	for i := 0; i < 3; i++ {
+		select {
+		case p := <-removed:
+			assert.Equal(t, targets[0].Path, p.Path, "path of the removed target %s", p.Container)
+			assert.Equal(t, targets[0].RunPath, p.RunPath, "run path of the removed target %s", p.Container)
+			if i < 2 {
+				assert.True(t, active.Active(fileName), "the pod is active until all its containers are removed")
+			}
+			active.Remove(p)
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "timed out waiting for the removed targets")
+		}
+	}
+	assert.False(t, active.Active(fileName), "the log of a deleted pod should be evicted")
+	assert.Equal(t, 0, active.Len(), "active containers")
+}
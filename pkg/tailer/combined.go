@@ -0,0 +1,198 @@
+package tailer
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
+	"github.com/jenkins-x/jx-test-collector/pkg/logfiles"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// CombinedLogFileName the name of the file in the pod and pipeline run directories containing the
+	// interleaved lines of all the containers
+	CombinedLogFileName = logfiles.CombinedLogFileName
+
+	// DefaultCombinedLogDelay the default time lines are buffered so that they can be ordered by timestamp
+	DefaultCombinedLogDelay = 2 * time.Second
+)
+
+// CombinedLogs writes the lines of multiple containers into combined log files ordered by timestamp.
+//
+// Lines are buffered for the Delay so that lines arriving from different containers can be sorted
+// before being written.
+type CombinedLogs struct {
+	// Delay how long lines are buffered before being written
+	Delay time.Duration
+
+	// Limits the optional limits on the size of each combined log file
+	Limits *LogLimits
+
+	lock      sync.Mutex
+	logs      map[string]*combinedLog
+	started   bool
+	startedAt time.Time
+}
+
+type combinedLog struct {
+	fileName string
+	file     *os.File
+	limited  *LimitedWriter
+	writer   *bufio.Writer
+	pending  []*combinedLine
+	refs     int
+}
+
+type combinedLine struct {
+	timestamp time.Time
+	text      string
+}
+
+// combinedOutput writes the lines of a container to a combined log
+type combinedOutput struct {
+	logs     *CombinedLogs
+	fileName string
+	prefix   string
+}
+
+// Output returns the output to write the lines of a container into the given combined log file with
+// the given prefix. The file is closed once all of the outputs for it have been closed.
+func (c *CombinedLogs) Output(fileName, prefix string) Output {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.logs == nil {
+		c.logs = map[string]*combinedLog{}
+	}
+	if !c.started {
+		c.started = true
+		// lets allow for file systems which store modification times in seconds
+		c.startedAt = time.Now().Truncate(time.Second)
+		go c.run()
+	}
+	l := c.logs[fileName]
+	if l == nil {
+		l = &combinedLog{fileName: fileName}
+		c.logs[fileName] = l
+	}
+	l.refs++
+	return &combinedOutput{
+		logs:     c,
+		fileName: fileName,
+		prefix:   prefix,
+	}
+}
+
+// Write adds the line to the combined log
+func (o *combinedOutput) Write(line *Line) {
+	ts := line.Timestamp
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	text := ts.UTC().Format(time.RFC3339Nano) + " [" + o.prefix + "] " + line.Message + "\n"
+
+	c := o.logs
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	l := c.logs[o.fileName]
+	if l != nil {
+		l.pending = append(l.pending, &combinedLine{timestamp: ts, text: text})
+	}
+}
+
+// Close flushes and closes the combined log if there are no more containers writing to it
+func (o *combinedOutput) Close() {
+	c := o.logs
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	l := c.logs[o.fileName]
+	if l == nil {
+		return
+	}
+	l.refs--
+	if l.refs > 0 {
+		return
+	}
+	c.flush(l, time.Time{})
+	if l.file != nil {
+		l.writer.Flush()
+		dropped, err := l.limited.Close()
+		if err != nil {
+			logrus.WithError(err).Warnf("failed to write the tail of the truncated combined log %s", l.fileName)
+		}
+		if dropped > 0 {
+			logrus.Infof("truncated %d bytes of the combined log %s", dropped, l.fileName)
+		}
+		l.file.Close()
+	}
+	delete(c.logs, o.fileName)
+}
+
+// run periodically writes the buffered lines which are older than the delay
+func (c *CombinedLogs) run() {
+	delay := c.Delay
+	if delay <= 0 {
+		delay = DefaultCombinedLogDelay
+	}
+	ticker := time.NewTicker(delay / 2)
+	for range ticker.C {
+		c.lock.Lock()
+		before := time.Now().Add(-delay)
+		for _, l := range c.logs {
+			c.flush(l, before)
+		}
+		c.lock.Unlock()
+	}
+}
+
+// flush writes the pending lines before the given time or all lines if the time is zero
+func (c *CombinedLogs) flush(l *combinedLog, before time.Time) {
+	if len(l.pending) == 0 {
+		return
+	}
+	sort.SliceStable(l.pending, func(i, j int) bool {
+		return l.pending[i].timestamp.Before(l.pending[j].timestamp)
+	})
+	idx := len(l.pending)
+	if !before.IsZero() {
+		idx = sort.Search(len(l.pending), func(i int) bool {
+			return l.pending[i].timestamp.After(before)
+		})
+	}
+	if idx == 0 {
+		return
+	}
+
+	if l.file == nil {
+		// lets truncate any file left by a previous collector which was last written before these logs started
+		flags := os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		info, err := os.Stat(l.fileName)
+		if err == nil && info.ModTime().Before(c.startedAt) {
+			flags |= os.O_TRUNC
+		}
+		err = os.MkdirAll(filepath.Dir(l.fileName), files.DefaultDirWritePermissions)
+		if err == nil {
+			l.file, err = os.OpenFile(l.fileName, flags, files.DefaultFileWritePermissions)
+		}
+		if err != nil {
+			logrus.WithError(err).Errorf("failed to open combined log %s", l.fileName)
+			l.pending = nil
+			return
+		}
+		l.limited = NewLimitedWriter(l.file, c.Limits)
+		l.writer = bufio.NewWriter(l.limited)
+	}
+	for _, line := range l.pending[:idx] {
+		// lets flush each line so that any truncation happens on a line boundary
+		l.writer.WriteString(line.text)
+		l.writer.Flush()
+	}
+	l.pending = l.pending[idx:]
+}
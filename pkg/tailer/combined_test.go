@@ -0,0 +1,100 @@
+package tailer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/tailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCombinedLogs(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	fileName := filepath.Join(tmpDir, tailer.CombinedLogFileName)
+	c := &tailer.CombinedLogs{Delay: time.Hour}
+	build := c.Output(fileName, "step-build")
+	test := c.Output(fileName, "step-test")
+
+	start := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	build.Write(&tailer.Line{Timestamp: start, Message: "compiling"})
+	build.Write(&tailer.Line{Timestamp: start.Add(2 * time.Second), Message: "compiled"})
+	test.Write(&tailer.Line{Timestamp: start.Add(time.Second), Message: "testing"})
+	build.Close()
+	test.Close()
+
+	data, err := ioutil.ReadFile(fileName)
+	require.NoError(t, err, "failed to load file %s", fileName)
+
+	expected := `2021-06-01T10:00:00Z [step-build] compiling
+2021-06-01T10:00:01Z [step-test] testing
+2021-06-01T10:00:02Z [step-build] compiled
+`
+	assert.Equal(t, expected, string(data), "combined log")
+}
+
+func TestCombinedLogsLimits(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	fileName := filepath.Join(tmpDir, tailer.CombinedLogFileName)
+	c := &tailer.CombinedLogs{
+		Delay:  time.Hour,
+		Limits: tailer.NewLogLimits(100, 50, 50, nil),
+	}
+	build := c.Output(fileName, "build")
+
+	start := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		build.Write(&tailer.Line{Timestamp: start.Add(time.Duration(i) * time.Second), Message: "line " + strconv.Itoa(i)})
+	}
+	build.Close()
+
+	data, err := ioutil.ReadFile(fileName)
+	require.NoError(t, err, "failed to load file %s", fileName)
+
+	expected := `2021-06-01T10:00:00Z [build] line 0
+
+... [jx-test-collector] truncated 288 bytes of log output ...
+
+2021-06-01T10:00:09Z [build] line 9
+`
+	assert.Equal(t, expected, string(data), "combined log")
+}
+
+func TestCombinedLogsReopened(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	// lets simulate a file left by a previous collector
+	fileName := filepath.Join(tmpDir, tailer.CombinedLogFileName)
+	err = ioutil.WriteFile(fileName, []byte("previous collector\n"), 0600)
+	require.NoError(t, err, "failed to save file %s", fileName)
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(fileName, old, old), "failed to change the times of %s", fileName)
+
+	c := &tailer.CombinedLogs{Delay: time.Hour}
+	start := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	build := c.Output(fileName, "step-build")
+	build.Write(&tailer.Line{Timestamp: start, Message: "compiling"})
+	build.Close()
+
+	// a pod of the same pipeline run started later appends to the combined log
+	test := c.Output(fileName, "step-test")
+	test.Write(&tailer.Line{Timestamp: start.Add(time.Second), Message: "testing"})
+	test.Close()
+
+	data, err := ioutil.ReadFile(fileName)
+	require.NoError(t, err, "failed to load file %s", fileName)
+
+	expected := `2021-06-01T10:00:00Z [step-build] compiling
+2021-06-01T10:00:01Z [step-test] testing
+`
+	assert.Equal(t, expected, string(data), "combined log")
+}
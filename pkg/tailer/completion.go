@@ -0,0 +1,203 @@
+package tailer
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+)
+
+// PipelineActivityResource the resource of the jx PipelineActivity
+var PipelineActivityResource = schema.GroupVersionResource{Group: "jenkins.io", Version: "v1", Resource: "pipelineactivities"}
+
+// terminalActivityStatuses the statuses of a PipelineActivity which has completed
+var terminalActivityStatuses = map[string]bool{
+	"Succeeded":   true,
+	"Failed":      true,
+	"Error":       true,
+	"Aborted":     true,
+	"NotExecuted": true,
+}
+
+// PodCompleted returns true if the pod is part of a tekton pipeline run and has terminated
+func PodCompleted(pod *corev1.Pod) bool {
+	if pod.Labels[PipelineRunLabel] == "" {
+		return false
+	}
+	return pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed
+}
+
+// ActivityCompleted returns true if the PipelineActivity has reached a terminal status
+func ActivityCompleted(activity *unstructured.Unstructured) bool {
+	status, _, _ := unstructured.NestedString(activity.Object, "spec", "status")
+	return terminalActivityStatuses[status]
+}
+
+// Debouncer invokes Fn once the triggers have been quiet for the Delay so that a burst of triggers
+// results in a single invocation.
+//
+// If MaxDelay is positive Fn is invoked at most MaxDelay after the first trigger of a burst even if the
+// triggers continue
+type Debouncer struct {
+	Delay    time.Duration
+	MaxDelay time.Duration
+	Fn       func()
+
+	lock  sync.Mutex
+	timer *time.Timer
+	first time.Time
+	gen   int
+}
+
+// Trigger schedules the invocation of Fn after the delay, postponing any pending invocation
+func (d *Debouncer) Trigger() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	now := time.Now()
+	if d.timer == nil {
+		d.first = now
+	} else {
+		if d.MaxDelay > 0 && now.Sub(d.first)+d.Delay > d.MaxDelay {
+			// lets not postpone the pending invocation any further
+			return
+		}
+		d.timer.Stop()
+	}
+	d.gen++
+	gen := d.gen
+	d.timer = time.AfterFunc(d.Delay, func() {
+		d.lock.Lock()
+		if d.gen != gen {
+			d.lock.Unlock()
+			return
+		}
+		d.timer = nil
+		d.lock.Unlock()
+
+		d.Fn()
+	})
+}
+
+// Stop cancels any pending invocation
+func (d *Debouncer) Stop() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.gen++
+}
+
+// completions triggers a sync once for each pipeline pod and PipelineActivity which completes
+type completions struct {
+	debouncer *Debouncer
+
+	lock sync.Mutex
+	done map[string]bool
+}
+
+// update triggers a sync the first time the object is seen in a terminal state
+func (c *completions) update(key string, terminal bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !terminal {
+		delete(c.done, key)
+		return
+	}
+	if c.done[key] {
+		return
+	}
+	if c.done == nil {
+		c.done = map[string]bool{}
+	}
+	c.done[key] = true
+	c.debouncer.Trigger()
+}
+
+// remove forgets about a deleted object
+func (c *completions) remove(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.done, key)
+}
+
+// onPod triggers a sync when a pipeline pod completes
+func (o *Options) onPod(pod *corev1.Pod, eventType watch.EventType) {
+	if o.completions == nil {
+		return
+	}
+	key := "pod/" + pod.Namespace + "/" + pod.Name
+	if eventType == watch.Deleted {
+		o.completions.remove(key)
+		return
+	}
+	o.completions.update(key, PodCompleted(pod))
+}
+
+// watchActivities triggers a sync when a PipelineActivity completes. If the PipelineActivity resource
+// is not available a warning is logged and only pipeline pods trigger syncs
+func (o *Options) watchActivities(ctx context.Context, client dynamic.Interface, namespace string) {
+	i := client.Resource(PipelineActivityResource).Namespace(namespace)
+	watchFn := func() (watch.Interface, error) {
+		return i.Watch(ctx, metav1.ListOptions{})
+	}
+	watcher, err := watchFn()
+	if err != nil {
+		logrus.WithError(err).Warn("failed to watch PipelineActivity resources so only pipeline pods will trigger syncs")
+		return
+	}
+
+	go func() {
+		for {
+			select {
+			case e, ok := <-watcher.ResultChan():
+				if !ok || e.Object == nil || e.Type == watch.Error {
+					watcher.Stop()
+					watcher = rewatch(ctx, "PipelineActivity", watchFn)
+					if watcher == nil {
+						return
+					}
+					continue
+				}
+				activity, ok := e.Object.(*unstructured.Unstructured)
+				if !ok || activity == nil {
+					continue
+				}
+				key := "activity/" + activity.GetNamespace() + "/" + activity.GetName()
+				if e.Type == watch.Deleted {
+					o.completions.remove(key)
+					continue
+				}
+				o.completions.update(key, ActivityCompleted(activity))
+			case <-ctx.Done():
+				watcher.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// syncOnCompletion performs the sync triggered by completed pipelines
+func (o *Options) syncOnCompletion() {
+	record, err := o.DoSync()
+	l := logrus.WithFields(map[string]interface{}{
+		"sync":    "git",
+		"trigger": "completion",
+	})
+	if err != nil {
+		l = l.WithError(err)
+	}
+	l.Info(record.String())
+}
@@ -0,0 +1,85 @@
+package tailer_test
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/tailer"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDebouncer(t *testing.T) {
+	var count int32
+	d := &tailer.Debouncer{
+		Delay: 50 * time.Millisecond,
+		Fn: func() {
+			atomic.AddInt32(&count, 1)
+		},
+	}
+	for i := 0; i < 5; i++ {
+		d.Trigger()
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, int32(0), atomic.LoadInt32(&count), "should not invoke during a burst")
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&count) == 1
+	}, time.Second, 10*time.Millisecond, "should invoke once after the burst")
+
+	d.Trigger()
+	d.Stop()
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count), "should not invoke after stopping")
+}
+
+func TestDebouncerMaxDelay(t *testing.T) {
+	var count int32
+	d := &tailer.Debouncer{
+		Delay:    50 * time.Millisecond,
+		MaxDelay: 120 * time.Millisecond,
+		Fn: func() {
+			atomic.AddInt32(&count, 1)
+		},
+	}
+	defer d.Stop()
+
+	// lets keep triggering faster than the delay
+	for i := 0; i < 20; i++ {
+		d.Trigger()
+		time.Sleep(20 * time.Millisecond)
+	}
+	invoked := atomic.LoadInt32(&count)
+	assert.True(t, invoked >= 2, "should invoke despite continuous triggers but was invoked %d times", invoked)
+}
+
+func TestPodCompleted(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "myorg-myrepo-pr-1-2-pod",
+			Labels: map[string]string{tailer.PipelineRunLabel: "myorg-myrepo-pr-1-2"},
+		},
+		Status: corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+	assert.False(t, tailer.PodCompleted(pod), "running pod")
+
+	pod.Status.Phase = corev1.PodFailed
+	assert.True(t, tailer.PodCompleted(pod), "failed pod")
+
+	pod.Labels = nil
+	assert.False(t, tailer.PodCompleted(pod), "pod which is not part of a pipeline")
+}
+
+func TestActivityCompleted(t *testing.T) {
+	activity := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{"status": "Running"},
+	}}
+	assert.False(t, tailer.ActivityCompleted(activity), "running activity")
+
+	for _, status := range []string{"Succeeded", "Failed", "Aborted"} {
+		activity.Object["spec"].(map[string]interface{})["status"] = status
+		assert.True(t, tailer.ActivityCompleted(activity), "activity with status %s", status)
+	}
+}
@@ -0,0 +1,344 @@
+package tailer
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/masker"
+	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
+	"github.com/jenkins-x/jx-test-collector/pkg/logfiles"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// EventsFileName the name of the file in the pod log directory containing the events
+	EventsFileName = logfiles.EventsFileName
+)
+
+// EventRecord is a deduplicated event for an involved object
+type EventRecord struct {
+	Type           string      `json:"type,omitempty"`
+	Reason         string      `json:"reason,omitempty"`
+	Message        string      `json:"message,omitempty"`
+	Source         string      `json:"source,omitempty"`
+	Count          int32       `json:"count"`
+	FirstTimestamp metav1.Time `json:"firstTimestamp"`
+	LastTimestamp  metav1.Time `json:"lastTimestamp"`
+}
+
+// InvolvedEvents the deduplicated events for an involved object
+type InvolvedEvents struct {
+	Kind      string         `json:"kind"`
+	Namespace string         `json:"namespace,omitempty"`
+	Name      string         `json:"name"`
+	Events    []*EventRecord `json:"events"`
+
+	records map[string]*EventRecord
+	counts  map[string]int32
+}
+
+// EventCollector watches kubernetes events and writes them for each involved object
+// into the pod log directory and the resources tree
+type EventCollector struct {
+	// LogDir the directory pod logs are written to
+	LogDir string
+
+	// ResourceDir the directory resources are dumped to
+	ResourceDir string
+
+	// Layout the layout of the pod directories; defaults to DefaultLayout()
+	Layout Layout
+
+	// KubeClient the client used to watch events and lookup pods
+	KubeClient kubernetes.Interface
+
+	// Masker for masking secrets in events
+	Masker *masker.Client
+
+	lock    sync.Mutex
+	objects map[string]*InvolvedEvents
+	podDirs map[string]string
+}
+
+// Start watches the events in the given namespace until the context is done
+func (c *EventCollector) Start(ctx context.Context, namespace string) error {
+	watchFn := func() (watch.Interface, error) {
+		return c.KubeClient.CoreV1().Events(namespace).Watch(ctx, metav1.ListOptions{Watch: true})
+	}
+	watcher, err := watchFn()
+	if err != nil {
+		return errors.Wrap(err, "failed to set up events watch")
+	}
+
+	go func() {
+		for {
+			select {
+			case e, ok := <-watcher.ResultChan():
+				if !ok || e.Object == nil || e.Type == watch.Error {
+					// closed because of an error or a server side timeout so lets watch again
+					watcher.Stop()
+					watcher = rewatch(ctx, "event", watchFn)
+					if watcher == nil {
+						return
+					}
+					continue
+				}
+				event, ok := e.Object.(*corev1.Event)
+				if !ok || event == nil {
+					continue
+				}
+				if e.Type == watch.Deleted {
+					c.OnEventDeleted(event)
+					continue
+				}
+				if e.Type != watch.Added && e.Type != watch.Modified {
+					continue
+				}
+				err := c.OnEvent(ctx, event)
+				if err != nil {
+					logrus.WithError(err).WithFields(map[string]interface{}{
+						"Namespace": event.Namespace,
+						"Event":     event.Name,
+					}).Warn("failed to save event")
+				}
+			case <-ctx.Done():
+				watcher.Stop()
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// OnEvent records the event and rewrites the files for its involved object
+func (c *EventCollector) OnEvent(ctx context.Context, event *corev1.Event) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.objects == nil {
+		c.objects = map[string]*InvolvedEvents{}
+	}
+	obj := event.InvolvedObject
+	ns := involvedNamespace(event)
+	key := involvedKey(obj.Kind, ns, obj.Name)
+	involved := c.objects[key]
+	if involved == nil {
+		involved = &InvolvedEvents{
+			Kind:      obj.Kind,
+			Namespace: ns,
+			Name:      obj.Name,
+			records:   map[string]*EventRecord{},
+			counts:    map[string]int32{},
+		}
+		c.objects[key] = involved
+	}
+	if !involved.add(event, c.mask) {
+		return nil
+	}
+
+	err := c.writeResource(involved)
+	if err != nil {
+		return err
+	}
+	if obj.Kind != "Pod" {
+		return nil
+	}
+	podDir := c.podDir(ctx, ns, obj.Name)
+	if podDir == "" {
+		return nil
+	}
+	return c.writeLog(involved, podDir)
+}
+
+// OnEventDeleted forgets about an expired event, removing its involved object from memory once all
+// of its events have expired. The files already written are kept
+func (c *EventCollector) OnEventDeleted(event *corev1.Event) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	obj := event.InvolvedObject
+	key := involvedKey(obj.Kind, involvedNamespace(event), obj.Name)
+	involved := c.objects[key]
+	if involved == nil {
+		return
+	}
+	delete(involved.counts, string(event.UID))
+	if len(involved.counts) == 0 {
+		delete(c.objects, key)
+	}
+}
+
+// OnPodDeleted forgets about the events and log directory of a deleted pod. The files already written are kept
+func (c *EventCollector) OnPodDeleted(ns, name string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.objects, involvedKey("Pod", ns, name))
+	delete(c.podDirs, ns+"/"+name)
+}
+
+// Tracked returns the number of involved objects whose events are held in memory
+func (c *EventCollector) Tracked() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return len(c.objects)
+}
+
+func involvedNamespace(event *corev1.Event) string {
+	if event.InvolvedObject.Namespace != "" {
+		return event.InvolvedObject.Namespace
+	}
+	return event.Namespace
+}
+
+func involvedKey(kind, ns, name string) string {
+	return strings.Join([]string{kind, ns, name}, "/")
+}
+
+// add adds the event, returning false if the event has already been recorded
+func (e *InvolvedEvents) add(event *corev1.Event, mask func(string) string) bool {
+	count := event.Count
+	if count <= 0 {
+		count = 1
+	}
+	previous := e.counts[string(event.UID)]
+	if count <= previous {
+		return false
+	}
+	e.counts[string(event.UID)] = count
+
+	source := event.Source.Component
+	if event.Source.Host != "" {
+		source += ", " + event.Source.Host
+	}
+	message := mask(strings.TrimSpace(event.Message))
+	key := strings.Join([]string{event.Type, event.Reason, source, message}, "\n")
+
+	first := event.FirstTimestamp
+	if first.IsZero() {
+		first = metav1.NewTime(event.EventTime.Time)
+	}
+	last := event.LastTimestamp
+	if last.IsZero() {
+		last = first
+	}
+
+	r := e.records[key]
+	if r == nil {
+		r = &EventRecord{
+			Type:           event.Type,
+			Reason:         event.Reason,
+			Message:        message,
+			Source:         source,
+			FirstTimestamp: first,
+			LastTimestamp:  last,
+		}
+		e.records[key] = r
+		e.Events = append(e.Events, r)
+	}
+	r.Count += count - previous
+	if !first.IsZero() && (r.FirstTimestamp.IsZero() || first.Before(&r.FirstTimestamp)) {
+		r.FirstTimestamp = first
+	}
+	if r.LastTimestamp.Before(&last) {
+		r.LastTimestamp = last
+	}
+	sort.SliceStable(e.Events, func(i, j int) bool {
+		return e.Events[i].FirstTimestamp.Before(&e.Events[j].FirstTimestamp)
+	})
+	return true
+}
+
+func (c *EventCollector) mask(text string) string {
+	if c.Masker == nil {
+		return text
+	}
+	return c.Masker.Mask(text)
+}
+
+// podDir returns the log directory of the pod, looking up the pod if it's not been seen before
+func (c *EventCollector) podDir(ctx context.Context, ns, name string) string {
+	if c.podDirs == nil {
+		c.podDirs = map[string]string{}
+	}
+	key := ns + "/" + name
+	dir := c.podDirs[key]
+	if dir != "" {
+		return dir
+	}
+	pod, err := c.KubeClient.CoreV1().Pods(ns).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		logrus.WithError(err).WithFields(map[string]interface{}{
+			"Namespace": ns,
+			"Pod":       name,
+		}).Debug("cannot find pod for event")
+		return ""
+	}
+	layout := c.Layout
+	if layout == nil {
+		layout = DefaultLayout()
+	}
+	dir = filepath.Join(c.LogDir, layout.PodPath(pod))
+	c.podDirs[key] = dir
+	return dir
+}
+
+func (c *EventCollector) writeResource(involved *InvolvedEvents) error {
+	dir := filepath.Join(c.ResourceDir, "core", "v1", "events")
+	if involved.Namespace != "" {
+		dir = filepath.Join(dir, involved.Namespace)
+	}
+	dir = filepath.Join(dir, strings.ToLower(involved.Kind))
+	err := os.MkdirAll(dir, files.DefaultDirWritePermissions)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create directory %s", dir)
+	}
+
+	fileName := filepath.Join(dir, involved.Name+".yaml")
+	data, err := yaml.Marshal(involved)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal events to YAML for file %s", fileName)
+	}
+	err = ioutil.WriteFile(fileName, data, files.DefaultFileWritePermissions)
+	if err != nil {
+		return errors.Wrapf(err, "failed to save file %s", fileName)
+	}
+	return nil
+}
+
+func (c *EventCollector) writeLog(involved *InvolvedEvents, podDir string) error {
+	err := os.MkdirAll(podDir, files.DefaultDirWritePermissions)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create directory %s", podDir)
+	}
+
+	buf := strings.Builder{}
+	for _, r := range involved.Events {
+		countText := ""
+		if r.Count > 1 {
+			countText = fmt.Sprintf(" (x%d since %s)", r.Count, r.FirstTimestamp.UTC().Format(time.RFC3339))
+		}
+		buf.WriteString(fmt.Sprintf("%s %-7s %s%s %s: %s\n", r.LastTimestamp.UTC().Format(time.RFC3339), r.Type, r.Reason, countText, r.Source, r.Message))
+	}
+
+	fileName := filepath.Join(podDir, EventsFileName)
+	err = ioutil.WriteFile(fileName, []byte(buf.String()), files.DefaultFileWritePermissions)
+	if err != nil {
+		return errors.Wrapf(err, "failed to save file %s", fileName)
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package tailer_test
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/masker"
+	"github.com/jenkins-x/jx-test-collector/pkg/tailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestEventCollector(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+	t.Logf("running in dir %s", tmpDir)
+
+	ns := "jx"
+	podName := "mypod"
+	kubeClient := fake.NewSimpleClientset(
+		&corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      podName,
+				Namespace: ns,
+				Labels: map[string]string{
+					"app": "myapp",
+				},
+			},
+		},
+	)
+
+	c := &tailer.EventCollector{
+		LogDir:      filepath.Join(tmpDir, "logs"),
+		ResourceDir: filepath.Join(tmpDir, "resources"),
+		KubeClient:  kubeClient,
+		Masker: &masker.Client{
+			ReplaceWords: map[string]string{"s3cr3tvalue": "****"},
+		},
+	}
+
+	newEvent := func(uid string, count int32) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      podName + "." + uid,
+				Namespace: ns,
+				UID:       types.UID(uid),
+			},
+			InvolvedObject: corev1.ObjectReference{
+				Kind:      "Pod",
+				Namespace: ns,
+				Name:      podName,
+			},
+			Type:    "Warning",
+			Reason:  "Failed",
+			Message: "Failed to pull image \"myimage:s3cr3tvalue\"",
+			Source:  corev1.EventSource{Component: "kubelet"},
+			Count:   count,
+		}
+	}
+
+	ctx := context.TODO()
+	for _, e := range []*corev1.Event{newEvent("a", 1), newEvent("a", 2), newEvent("a", 2), newEvent("b", 1)} {
+		err = c.OnEvent(ctx, e)
+		require.NoError(t, err, "failed to process event %s", e.Name)
+	}
+
+	logFile := filepath.Join(tmpDir, "logs", ns, "myapp", podName, tailer.EventsFileName)
+	require.FileExists(t, logFile)
+	data, err := ioutil.ReadFile(logFile)
+	require.NoError(t, err, "failed to load file %s", logFile)
+	text := string(data)
+	t.Logf("%s\n", text)
+
+	assert.Contains(t, text, "Failed (x3 since", "events should be deduplicated")
+	assert.Contains(t, text, "myimage:****", "events should be masked")
+	assert.NotContains(t, text, "s3cr3tvalue", "events should be masked")
+
+	require.FileExists(t, filepath.Join(tmpDir, "resources", "core", "v1", "events", ns, "pod", podName+".yaml"))
+}
+
+func TestEventCollectorForgetsDeletedObjects(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	ns := "jx"
+	c := &tailer.EventCollector{
+		LogDir:      filepath.Join(tmpDir, "logs"),
+		ResourceDir: filepath.Join(tmpDir, "resources"),
+		KubeClient:  fake.NewSimpleClientset(),
+	}
+	newEvent := func(kind, name, uid string) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name + "." + uid,
+				Namespace: ns,
+				UID:       types.UID(uid),
+			},
+			InvolvedObject: corev1.ObjectReference{
+				Kind:      kind,
+				Namespace: ns,
+				Name:      name,
+			},
+			Type:    "Normal",
+			Reason:  "Created",
+			Message: "created",
+			Count:   1,
+		}
+	}
+
+	ctx := context.TODO()
+	podEvent := newEvent("Pod", "mypod", "a")
+	runEvents := []*corev1.Event{newEvent("PipelineRun", "myrun", "b"), newEvent("PipelineRun", "myrun", "c")}
+	for _, e := range append([]*corev1.Event{podEvent}, runEvents...) {
+		err = c.OnEvent(ctx, e)
+		require.NoError(t, err, "failed to process event %s", e.Name)
+	}
+	assert.Equal(t, 2, c.Tracked(), "tracked objects")
+
+	c.OnPodDeleted(ns, "mypod")
+	assert.Equal(t, 1, c.Tracked(), "tracked objects after the pod is deleted")
+
+	c.OnEventDeleted(runEvents[0])
+	assert.Equal(t, 1, c.Tracked(), "tracked objects while the PipelineRun has events")
+	c.OnEventDeleted(runEvents[1])
+	assert.Equal(t, 0, c.Tracked(), "tracked objects after all the events expired")
+
+	require.FileExists(t, filepath.Join(tmpDir, "resources", "core", "v1", "events", ns, "pipelinerun", "myrun.yaml"), "files should be kept")
+}
+
+func TestEventCollectorReconnects(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	kubeClient := fake.NewSimpleClientset()
+	watchers := make(chan *watch.FakeWatcher, 2)
+	kubeClient.PrependWatchReactor("events", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		w := watch.NewFake()
+		watchers <- w
+		return true, w, nil
+	})
+	c := &tailer.EventCollector{
+		LogDir:      filepath.Join(tmpDir, "logs"),
+		ResourceDir: filepath.Join(tmpDir, "resources"),
+		KubeClient:  kubeClient,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	err = c.Start(ctx, "jx")
+	require.NoError(t, err, "failed to start")
+
+	// lets simulate a server side timeout of the first watch
+	first := <-watchers
+	first.Stop()
+
+	var second *watch.FakeWatcher
+	select {
+	case second = <-watchers:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "the event watch was not reconnected")
+	}
+	second.Add(&corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Name: "myrun.a", Namespace: "jx", UID: "a"},
+		InvolvedObject: corev1.ObjectReference{Kind: "PipelineRun", Namespace: "jx", Name: "myrun"},
+		Reason:         "Started",
+		Count:          1,
+	})
+	assert.Eventually(t, func() bool {
+		return c.Tracked() == 1
+	}, 5*time.Second, 10*time.Millisecond, "should collect events after reconnecting")
+}
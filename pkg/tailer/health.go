@@ -0,0 +1,129 @@
+package tailer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Health tracks the state of the background work of the collector for the readiness and liveness checks.
+//
+// The collector is ready once the git store is set up and the pod watch is running. It is no longer live
+// if the pod watch has stopped, the sync loop has not completed an iteration in time or too many
+// consecutive syncs have failed so that Kubernetes can restart it
+type Health struct {
+	// MaxSyncFailures the number of consecutive failed syncs after which the collector is not live. Zero disables the check
+	MaxSyncFailures int `env:"MAX_SYNC_FAILURES,default=3"`
+
+	// SyncTimeout how long a sync may take beyond the sync duration before the sync loop is considered wedged
+	SyncTimeout time.Duration `env:"SYNC_TIMEOUT,default=30m"`
+
+	// SyncDuration the duration between syncs of the sync loop
+	SyncDuration time.Duration
+
+	// Now returns the current time. Defaults to time.Now
+	Now func() time.Time
+
+	lock         sync.Mutex
+	setup        bool
+	watching     bool
+	watchStopped bool
+	looping      bool
+	lastLoop     time.Time
+	syncFailures int
+	lastSyncErr  error
+}
+
+// SetupDone records that the git store has been set up
+func (h *Health) SetupDone() {
+	h.lock.Lock()
+	h.setup = true
+	h.lock.Unlock()
+}
+
+// IsSetup returns true once the git store has been set up
+func (h *Health) IsSetup() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.setup
+}
+
+// Watching records whether the pod watch is currently connected
+func (h *Health) Watching(watching bool) {
+	h.lock.Lock()
+	h.watching = watching
+	h.lock.Unlock()
+}
+
+// WatchStopped records that the pod watch goroutine has terminated
+func (h *Health) WatchStopped() {
+	h.lock.Lock()
+	h.watching = false
+	h.watchStopped = true
+	h.lock.Unlock()
+}
+
+// LoopTick records that the sync loop is running and has completed an iteration
+func (h *Health) LoopTick() {
+	h.lock.Lock()
+	h.looping = true
+	h.lastLoop = h.now()
+	h.lock.Unlock()
+}
+
+// SyncResult records the outcome of a sync
+func (h *Health) SyncResult(err error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if err != nil {
+		h.syncFailures++
+		h.lastSyncErr = err
+		return
+	}
+	h.syncFailures = 0
+	h.lastSyncErr = nil
+}
+
+// Ready returns an error if the git store is not set up yet or the pod watch is not running
+func (h *Health) Ready() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if !h.setup {
+		return errors.Errorf("the git store is not set up yet")
+	}
+	if !h.watching {
+		return errors.Errorf("the pod watch is not running")
+	}
+	return nil
+}
+
+// Live returns an error if the pod watch has stopped, the sync loop is wedged or too many syncs have failed
+func (h *Health) Live() error {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.watchStopped {
+		return errors.Errorf("the pod watch has stopped")
+	}
+	if h.looping && h.SyncDuration > 0 {
+		limit := h.SyncDuration + h.SyncTimeout
+		if since := h.now().Sub(h.lastLoop); since > limit {
+			return errors.Errorf("the sync loop has not completed for %s", since.Round(time.Second).String())
+		}
+	}
+	if h.MaxSyncFailures > 0 && h.syncFailures >= h.MaxSyncFailures {
+		return errors.Wrapf(h.lastSyncErr, "the last %d syncs failed", h.syncFailures)
+	}
+	return nil
+}
+
+func (h *Health) now() time.Time {
+	if h.Now != nil {
+		return h.Now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,62 @@
+package tailer_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/tailer"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealth(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	h := &tailer.Health{
+		MaxSyncFailures: 3,
+		SyncTimeout:     time.Minute,
+		SyncDuration:    5 * time.Minute,
+		Now: func() time.Time {
+			return now
+		},
+	}
+
+	require.Error(t, h.Ready(), "should not be ready before set up")
+	require.NoError(t, h.Live(), "should be live while setting up")
+	assert.False(t, h.IsSetup(), "set up")
+	h.SetupDone()
+	assert.True(t, h.IsSetup(), "set up")
+	require.Error(t, h.Ready(), "should not be ready before watching")
+	h.Watching(true)
+	require.NoError(t, h.Ready(), "should be ready")
+	h.Watching(false)
+	require.Error(t, h.Ready(), "should not be ready while reconnecting the watch")
+	h.Watching(true)
+
+	h.LoopTick()
+	require.NoError(t, h.Live(), "should be live")
+
+	now = now.Add(5 * time.Minute)
+	require.NoError(t, h.Live(), "should be live within the sync duration")
+	now = now.Add(2 * time.Minute)
+	err := h.Live()
+	require.Error(t, err, "should not be live when the sync loop is wedged")
+	assert.Contains(t, err.Error(), "sync loop")
+	h.LoopTick()
+	require.NoError(t, h.Live(), "should be live after the sync loop completes")
+
+	for i := 0; i < 2; i++ {
+		h.SyncResult(errors.Errorf("push failed"))
+	}
+	require.NoError(t, h.Live(), "should be live with fewer failed syncs than the maximum")
+	h.SyncResult(errors.Errorf("push failed"))
+	err = h.Live()
+	require.Error(t, err, "should not be live after too many failed syncs")
+	assert.Equal(t, "the last 3 syncs failed: push failed", err.Error())
+	h.SyncResult(nil)
+	require.NoError(t, h.Live(), "should be live after a successful sync")
+
+	h.WatchStopped()
+	require.Error(t, h.Live(), "should not be live when the watch has stopped")
+	require.Error(t, h.Ready(), "should not be ready when the watch has stopped")
+}
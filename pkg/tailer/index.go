@@ -0,0 +1,52 @@
+package tailer
+
+import (
+	"path/filepath"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/logfiles"
+	"github.com/jenkins-x/jx-test-collector/pkg/search"
+)
+
+// indexOutput adds the lines of a container to the search index
+type indexOutput struct {
+	index    *search.Index
+	context  *search.Context
+	lines    int
+	bytes    int64
+	maxBytes int64
+}
+
+// newIndexOutput creates an output to index the lines of the target container. Lines beyond the maximum
+// size of a container log are not indexed so that a noisy container does not evict the lines of the others
+func (o *Options) newIndexOutput(target *Target, limits *LogLimits) Output {
+	maxBytes := int64(0)
+	if limits != nil {
+		maxBytes = limits.MaxBytes
+	}
+	return &indexOutput{
+		index:    o.search,
+		maxBytes: maxBytes,
+		context: &search.Context{
+			Namespace:   target.Namespace,
+			Pod:         target.Pod,
+			Container:   target.Container,
+			PipelineRun: target.PipelineRun,
+			Task:        target.Task,
+			LogFile:     filepath.ToSlash(filepath.Join(o.LogPath, target.Path, target.Container+logfiles.LogExtension)),
+		},
+	}
+}
+
+// Write indexes the line
+func (o *indexOutput) Write(line *Line) {
+	o.lines++
+	o.bytes += int64(len(line.Message)) + 1
+	if o.maxBytes > 0 && o.bytes > o.maxBytes {
+		return
+	}
+	o.index.Add(o.context, o.lines, line.Message, line.Timestamp)
+}
+
+// Close does nothing as lines are kept in the index until they are evicted
+func (o *indexOutput) Close() {
+}
@@ -0,0 +1,274 @@
+package tailer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
+	"github.com/jenkins-x/jx-test-collector/pkg/pathtemplate"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	// LayoutApp groups pod logs using the pod and run path templates which default to namespace and app
+	LayoutApp = "app"
+
+	// LayoutPipelineRun groups the pods of a tekton pipeline run by owner, repository, branch and build
+	LayoutPipelineRun = "pipelinerun"
+)
+
+var (
+	// samplePods used to validate path templates
+	samplePods = []*corev1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "myapp-5d8b9c7f4-x2x9z",
+				Namespace: "jx",
+				Labels: map[string]string{
+					"app": "myapp",
+				},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "myorg-myrepo-pr-1-2-from-build-pack-pod-abc",
+				Namespace: "jx",
+				Labels: map[string]string{
+					"app.kubernetes.io/managed-by": "tekton-pipelines",
+					"owner":                        "myorg",
+					"repository":                   "myrepo",
+					"branch":                       "PR-1",
+					"build":                        "2",
+					PipelineRunLabel:               "myorg-myrepo-pr-1-2",
+				},
+			},
+		},
+	}
+)
+
+// Layout determines the directories, relative to the log directory, in which the files of pods
+// and pipeline runs are stored
+type Layout interface {
+	// PodPath returns the path of the directory for the log files of the pod
+	PodPath(pod *corev1.Pod) string
+
+	// RunPath returns the path of the directory for the files of the pipeline run the pod belongs to
+	// or the pod path if it is not part of a pipeline run
+	RunPath(pod *corev1.Pod) string
+}
+
+// NewLayout creates the layout for the given name using the pod and run path templates which
+// default to pathtemplate.DefaultPodPathTemplate and pathtemplate.DefaultRunPathTemplate if not specified
+func NewLayout(name, podTemplate, runTemplate string) (Layout, error) {
+	if podTemplate == "" {
+		podTemplate = pathtemplate.DefaultPodPathTemplate
+	}
+	if runTemplate == "" {
+		runTemplate = pathtemplate.DefaultRunPathTemplate
+	}
+	podPath, err := pathtemplate.Parse("pod", podTemplate)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid pod path template")
+	}
+	runPath, err := pathtemplate.Parse("run", runTemplate)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid run path template")
+	}
+	var samples []*pathtemplate.Data
+	for _, pod := range samplePods {
+		samples = append(samples, pathtemplate.NewData(pod))
+	}
+	err = podPath.Validate(samples...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid pod path template")
+	}
+	err = runPath.Validate(samples...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid run path template")
+	}
+	layout := &TemplateLayout{
+		Pod: podPath,
+		Run: runPath,
+	}
+
+	switch name {
+	case "", LayoutApp:
+		return layout, nil
+	case LayoutPipelineRun:
+		return &PipelineRunLayout{Fallback: layout}, nil
+	default:
+		return nil, errors.Errorf("unknown layout %s. Supported values are: %s, %s", name, LayoutApp, LayoutPipelineRun)
+	}
+}
+
+// DefaultLayout returns the layout using the default path templates
+func DefaultLayout() Layout {
+	return &TemplateLayout{
+		Pod: pathtemplate.MustParse("pod", pathtemplate.DefaultPodPathTemplate),
+		Run: pathtemplate.MustParse("run", pathtemplate.DefaultRunPathTemplate),
+	}
+}
+
+// TemplateLayout evaluates go templates against the pod to create the pod and pipeline run directories.
+//
+// If a template fails to evaluate for a pod the default templates are used
+type TemplateLayout struct {
+	Pod *pathtemplate.Template
+	Run *pathtemplate.Template
+}
+
+// PodPath returns the path of the directory for the log files of the pod
+func (l *TemplateLayout) PodPath(pod *corev1.Pod) string {
+	return evaluatePath(l.Pod, pathtemplate.DefaultPodPathTemplate, pod)
+}
+
+// RunPath returns the path of the directory for the files of the pipeline run
+func (l *TemplateLayout) RunPath(pod *corev1.Pod) string {
+	return evaluatePath(l.Run, pathtemplate.DefaultRunPathTemplate, pod)
+}
+
+func evaluatePath(t *pathtemplate.Template, defaultTemplate string, pod *corev1.Pod) string {
+	data := pathtemplate.NewData(pod)
+	path, err := t.Path(data)
+	if err == nil {
+		return path
+	}
+	logrus.WithError(err).WithFields(map[string]interface{}{
+		"Namespace": pod.Namespace,
+		"Pod":       pod.Name,
+	}).Warn("failed to evaluate path template so using the default")
+
+	path, err = pathtemplate.MustParse("default", defaultTemplate).Path(data)
+	if err != nil {
+		return filepath.Join(pod.Namespace, pod.Name)
+	}
+	return path
+}
+
+// PipelineRunLayout stores all the pods of a tekton pipeline run in owner/repository/branch/build/pod
+// along with the PipelineRun and PipelineActivity resources.
+//
+// Pods which are not part of a pipeline run use the Fallback layout
+type PipelineRunLayout struct {
+	Fallback Layout
+}
+
+// PodPath returns the path of the directory for the log files of the pod
+func (l *PipelineRunLayout) PodPath(pod *corev1.Pod) string {
+	runPath := l.ObjectRunPath(pod, pod.Labels[PipelineRunLabel])
+	if runPath == "" {
+		return l.fallback().PodPath(pod)
+	}
+	return filepath.Join(runPath, pod.Name)
+}
+
+// RunPath returns the path of the directory for the files of the pipeline run
+func (l *PipelineRunLayout) RunPath(pod *corev1.Pod) string {
+	runPath := l.ObjectRunPath(pod, pod.Labels[PipelineRunLabel])
+	if runPath == "" {
+		return l.fallback().RunPath(pod)
+	}
+	return runPath
+}
+
+func (l *PipelineRunLayout) fallback() Layout {
+	if l.Fallback == nil {
+		l.Fallback = DefaultLayout()
+	}
+	return l.Fallback
+}
+
+// ObjectRunPath returns the pipeline run directory from the owner, repository, branch and build labels
+// of a pod, PipelineRun or PipelineActivity or an empty string if the labels are missing.
+//
+// If there is no build label the pipeline run name is used instead.
+func (l *PipelineRunLayout) ObjectRunPath(obj metav1.Object, pipelineRun string) string {
+	labels := obj.GetLabels()
+	if labels == nil || pipelineRun == "" {
+		return ""
+	}
+	owner := labels["owner"]
+	repository := labels["repository"]
+	branch := labels["branch"]
+	build := labels["build"]
+	if owner == "" || repository == "" {
+		return ""
+	}
+	if branch == "" {
+		branch = "unknown"
+	}
+	if build == "" {
+		build = pipelineRun
+	}
+	return filepath.Join(owner, repository, branch, build)
+}
+
+// saveRunResource saves the PipelineRun and PipelineActivity resources into the pipeline run directory
+func (o *Options) saveRunResource(r schema.GroupVersionResource, resource *unstructured.Unstructured, data []byte) error {
+	layout := &PipelineRunLayout{}
+	runPath := ""
+	fileName := ""
+	switch r.Resource {
+	case "pipelineruns":
+		runPath = layout.ObjectRunPath(resource, resource.GetName())
+		fileName = "pipelinerun.yaml"
+	case "pipelineactivities":
+		build, _, _ := unstructured.NestedString(resource.Object, "spec", "build")
+		obj := resource.DeepCopy()
+		labels := obj.GetLabels()
+		if labels != nil && labels["build"] == "" && build != "" {
+			labels["build"] = build
+			obj.SetLabels(labels)
+		}
+		runPath = layout.ObjectRunPath(obj, obj.GetName())
+		fileName = "pipelineactivity.yaml"
+	}
+	if runPath == "" {
+		return nil
+	}
+
+	dir := filepath.Join(o.Dir, o.LogPath, runPath)
+	err := os.MkdirAll(dir, files.DefaultDirWritePermissions)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create directory %s", dir)
+	}
+	path := filepath.Join(dir, fileName)
+	err = ioutil.WriteFile(path, data, files.DefaultFileWritePermissions)
+	if err != nil {
+		return errors.Wrapf(err, "failed to save file %s", path)
+	}
+	return nil
+}
+
+// AppPath returns the relative path of the application directory for the pod
+// which is derived from the app labels and, for tekton pods, the owner, repository and branch
+func AppPath(pod *corev1.Pod) string {
+	if pod.Labels == nil {
+		return ""
+	}
+	app := pod.Labels["app"]
+	if app == "" {
+		app = pod.Labels["app.kubernetes.io/managed-by"]
+	}
+	if app == "tekton-pipelines" {
+		owner := pod.Labels["owner"]
+		repository := pod.Labels["repository"]
+		branch := pod.Labels["branch"]
+		if owner != "" {
+			app = filepath.Join(app, owner)
+		}
+		if repository != "" {
+			app = filepath.Join(app, repository)
+		}
+		if branch != "" {
+			app = filepath.Join(app, branch)
+		}
+	}
+	return app
+}
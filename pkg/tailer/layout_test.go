@@ -0,0 +1,85 @@
+package tailer_test
+
+import (
+	"testing"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/tailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLayouts(t *testing.T) {
+	tektonPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myorg-myrepo-pr-1-2-from-build-pack-pod-abc",
+			Namespace: "jx",
+			Labels: map[string]string{
+				"app.kubernetes.io/managed-by": "tekton-pipelines",
+				"owner":                        "myorg",
+				"repository":                   "myrepo",
+				"branch":                       "PR-1",
+				"build":                        "2",
+				tailer.PipelineRunLabel:        "myorg-myrepo-pr-1-2",
+			},
+		},
+	}
+	appPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-abc",
+			Namespace: "jx",
+			Labels: map[string]string{
+				"app": "myapp",
+			},
+		},
+	}
+
+	testCases := []struct {
+		layout  string
+		pod     *corev1.Pod
+		podPath string
+		runPath string
+	}{
+		{tailer.LayoutApp, tektonPod, "jx/tekton-pipelines/myorg/myrepo/PR-1/myorg-myrepo-pr-1-2-from-build-pack-pod-abc", "jx/tekton-pipelines/myorg/myrepo/PR-1/myorg-myrepo-pr-1-2"},
+		{tailer.LayoutApp, appPod, "jx/myapp/myapp-abc", "jx/myapp/myapp-abc"},
+		{tailer.LayoutPipelineRun, tektonPod, "myorg/myrepo/PR-1/2/myorg-myrepo-pr-1-2-from-build-pack-pod-abc", "myorg/myrepo/PR-1/2"},
+		{tailer.LayoutPipelineRun, appPod, "jx/myapp/myapp-abc", "jx/myapp/myapp-abc"},
+	}
+	for _, tc := range testCases {
+		layout, err := tailer.NewLayout(tc.layout, "", "")
+		require.NoError(t, err, "failed to create layout %s", tc.layout)
+
+		assert.Equal(t, tc.podPath, layout.PodPath(tc.pod), "pod path for layout %s and pod %s", tc.layout, tc.pod.Name)
+		assert.Equal(t, tc.runPath, layout.RunPath(tc.pod), "run path for layout %s and pod %s", tc.layout, tc.pod.Name)
+	}
+
+	_, err := tailer.NewLayout("cheese", "", "")
+	require.Error(t, err, "should fail for an unknown layout")
+}
+
+func TestPathTemplates(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "myapp-abc",
+			Namespace: "jx",
+			Labels: map[string]string{
+				"team": "cheese",
+			},
+			Annotations: map[string]string{
+				"release": "v1.2.3",
+			},
+		},
+	}
+
+	layout, err := tailer.NewLayout(tailer.LayoutApp, `{{ index .Labels "team" }}/{{ index .Annotations "release" }}/{{ .Name }}`, "")
+	require.NoError(t, err, "failed to create layout")
+	assert.Equal(t, "cheese/v1.2.3/myapp-abc", layout.PodPath(pod), "pod path")
+	assert.Equal(t, "jx/myapp-abc", layout.RunPath(pod), "run path")
+
+	for _, text := range []string{"{{ .Name", "../{{ .Name }}", "{{ .Name }}/..", "{{ .Cheese }}"} {
+		_, err = tailer.NewLayout(tailer.LayoutApp, text, "")
+		require.Error(t, err, "should fail for template %s", text)
+		t.Logf("got expected error for template %s: %s\n", text, err.Error())
+	}
+}
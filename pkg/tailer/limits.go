@@ -0,0 +1,309 @@
+package tailer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/logfiles"
+)
+
+// DefaultTruncatedBytes the number of bytes kept at the start and the end of a truncated log if only the
+// total limit is specified
+const DefaultTruncatedBytes = 256 * 1024
+
+// LogLimits limits the size of a container log file by keeping the head and tail of the log
+// and dropping the middle if the log exceeds the maximum size
+type LogLimits struct {
+	// MaxBytes the maximum size of the log file. If zero only the Total limit applies
+	MaxBytes int64
+
+	// HeadBytes the number of bytes at the start of the log to keep when truncating
+	HeadBytes int64
+
+	// TailBytes the number of bytes at the end of the log to keep when truncating
+	TailBytes int64
+
+	// Total the optional limit on the size of all the container logs
+	Total *TotalLogBytes
+}
+
+// TotalLogBytes tracks the size of all the container logs against a global limit. The size is added to as
+// logs are written and is recomputed from the files written by this process by Update so that compressed,
+// evicted and deleted logs are no longer counted
+type TotalLogBytes struct {
+	// MaxBytes the maximum size of all the container logs
+	MaxBytes int64
+
+	bytes int64
+	lock  sync.Mutex
+	files map[string]bool
+}
+
+// Bytes returns the current size of all the container logs
+func (t *TotalLogBytes) Bytes() int64 {
+	if t == nil {
+		return 0
+	}
+	return atomic.LoadInt64(&t.bytes)
+}
+
+// track adds the file to the files whose size is counted by Update
+func (t *TotalLogBytes) track(fileName string) {
+	if t == nil || t.MaxBytes <= 0 {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.files == nil {
+		t.files = map[string]bool{}
+	}
+	t.files[fileName] = true
+}
+
+// Update recomputes the size of all the container logs from the size on disk of the files which have been
+// written or of their compressed files. Files which no longer exist are no longer tracked
+func (t *TotalLogBytes) Update() {
+	if t == nil || t.MaxBytes <= 0 {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	total := int64(0)
+	for fileName := range t.files {
+		info, err := os.Stat(fileName)
+		if err != nil {
+			info, err = os.Stat(fileName + logfiles.GzipExtension)
+		}
+		if err != nil {
+			delete(t.files, fileName)
+			continue
+		}
+		total += info.Size()
+	}
+	atomic.StoreInt64(&t.bytes, total)
+}
+
+// Tracked returns the number of files whose size is counted
+func (t *TotalLogBytes) Tracked() int {
+	if t == nil {
+		return 0
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return len(t.files)
+}
+
+// add adds the bytes returning true if the limit has been exceeded
+func (t *TotalLogBytes) add(n int) bool {
+	if t == nil || t.MaxBytes <= 0 {
+		return false
+	}
+	return atomic.AddInt64(&t.bytes, int64(n)) > t.MaxBytes
+}
+
+// NewLogLimits creates the limits for a container log. If the head and tail sizes are not
+// specified they default to half of the maximum size of a container log or DefaultTruncatedBytes
+// if there is only a total limit
+func NewLogLimits(maxBytes, headBytes, tailBytes int64, total *TotalLogBytes) *LogLimits {
+	if maxBytes <= 0 && (total == nil || total.MaxBytes <= 0) {
+		return nil
+	}
+	limit := maxBytes
+	if limit <= 0 {
+		limit = 2 * DefaultTruncatedBytes
+	}
+	if headBytes <= 0 {
+		headBytes = limit / 2
+	}
+	if tailBytes <= 0 {
+		tailBytes = limit / 2
+	}
+	if maxBytes > 0 && headBytes+tailBytes > maxBytes {
+		maxBytes = headBytes + tailBytes
+	}
+	return &LogLimits{
+		MaxBytes:  maxBytes,
+		HeadBytes: headBytes,
+		TailBytes: tailBytes,
+		Total:     total,
+	}
+}
+
+// TruncatedMarker returns the text written between the head and tail of a truncated log
+func TruncatedMarker(dropped int64) []byte {
+	return []byte(fmt.Sprintf("\n... [jx-test-collector] truncated %d bytes of log output ...\n\n", dropped))
+}
+
+// LimitedWriter writes to a log file until the limits are exceeded; the file is then truncated to the
+// last line in the head and the end of the log is kept in a ring buffer so that the tail can be written
+// when the writer is closed.
+//
+// Any content already in the file is kept as part of the head
+type LimitedWriter struct {
+	// Marker returns the text written between the head and the tail. Defaults to TruncatedMarker
+	Marker func(dropped int64) []byte
+
+	file      *os.File
+	limits    *LogLimits
+	written   int64
+	seen      int64
+	headEnd   int64
+	truncated bool
+
+	// tail the ring buffer of the last bytes written after the head
+	tail        []byte
+	tailStart   int
+	tailLen     int
+	tailDropped bool
+	lastDropped byte
+}
+
+// NewLimitedWriter creates a writer for the file with the given limits which may be nil
+func NewLimitedWriter(file *os.File, limits *LogLimits) *LimitedWriter {
+	w := &LimitedWriter{
+		file:   file,
+		limits: limits,
+	}
+	if limits != nil {
+		limits.Total.track(file.Name())
+		info, err := file.Stat()
+		if err == nil && info.Size() > 0 {
+			w.written = info.Size()
+			w.seen = info.Size()
+			w.headEnd = info.Size()
+		}
+	}
+	return w
+}
+
+// Write writes the bytes to the file or to the tail buffer once the log has been truncated
+func (w *LimitedWriter) Write(p []byte) (int, error) {
+	if w.limits == nil {
+		return w.file.Write(p)
+	}
+	w.seen += int64(len(p))
+	totalExceeded := w.limits.Total.add(len(p))
+
+	if !w.truncated {
+		exceeded := totalExceeded || (w.limits.MaxBytes > 0 && w.written+int64(len(p)) > w.limits.MaxBytes)
+		if !exceeded {
+			n, err := w.file.Write(p)
+			w.addWritten(p[:n])
+			return n, err
+		}
+
+		// lets remove everything after the head from the file as the tail is now kept in memory
+		err := w.file.Truncate(w.headEnd)
+		if err == nil {
+			_, err = w.file.Seek(w.headEnd, io.SeekStart)
+		}
+		if err != nil {
+			return 0, err
+		}
+		w.truncated = true
+	}
+	w.addTail(p)
+	return len(p), nil
+}
+
+// Truncated returns true if the limits have been exceeded
+func (w *LimitedWriter) Truncated() bool {
+	return w.truncated
+}
+
+// addWritten tracks the end of the last complete line in the head and the bytes after the head
+func (w *LimitedWriter) addWritten(p []byte) {
+	offset := w.written
+	w.written += int64(len(p))
+	if offset < w.limits.HeadBytes {
+		head := p
+		if w.written > w.limits.HeadBytes {
+			head = p[:w.limits.HeadBytes-offset]
+		}
+		idx := bytes.LastIndexByte(head, '\n')
+		if idx >= 0 {
+			w.headEnd = offset + int64(idx) + 1
+		}
+		p = p[len(head):]
+	}
+	w.addTail(p)
+}
+
+// addTail adds the bytes to the tail ring buffer overwriting the oldest bytes beyond the tail size
+func (w *LimitedWriter) addTail(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	size := int(w.limits.TailBytes)
+	if size <= 0 {
+		w.tailDropped = true
+		w.lastDropped = p[len(p)-1]
+		return
+	}
+	if w.tail == nil {
+		w.tail = make([]byte, size)
+	}
+	var skipped []byte
+	if len(p) > size {
+		skipped = p[:len(p)-size]
+		p = p[len(p)-size:]
+	}
+	if extra := w.tailLen + len(p) - size; extra > 0 {
+		w.tailDropped = true
+		w.lastDropped = w.tail[(w.tailStart+extra-1)%size]
+		w.tailStart = (w.tailStart + extra) % size
+		w.tailLen -= extra
+	}
+	if len(skipped) > 0 {
+		w.tailDropped = true
+		w.lastDropped = skipped[len(skipped)-1]
+	}
+	end := (w.tailStart + w.tailLen) % size
+	n := copy(w.tail[end:], p)
+	copy(w.tail, p[n:])
+	w.tailLen += len(p)
+}
+
+// tailBytes returns the contents of the tail buffer starting at the beginning of a line if bytes were dropped
+func (w *LimitedWriter) tailBytes() []byte {
+	answer := make([]byte, w.tailLen)
+	if w.tailLen > 0 {
+		n := copy(answer, w.tail[w.tailStart:])
+		copy(answer[n:], w.tail[:w.tailLen-n])
+	}
+	if w.tailDropped && w.lastDropped != '\n' {
+		idx := bytes.IndexByte(answer, '\n')
+		if idx >= 0 {
+			answer = answer[idx+1:]
+		}
+	}
+	return answer
+}
+
+// Close writes the truncation marker and the tail if the log was truncated returning the number of bytes dropped
+func (w *LimitedWriter) Close() (int64, error) {
+	if !w.truncated {
+		return 0, nil
+	}
+	tail := w.tailBytes()
+	dropped := w.seen - w.headEnd - int64(len(tail))
+	marker := w.Marker
+	if marker == nil {
+		marker = TruncatedMarker
+	}
+	_, err := w.file.Write(marker(dropped))
+	if err == nil {
+		_, err = w.file.Write(tail)
+	}
+	w.tail = nil
+	w.tailStart = 0
+	w.tailLen = 0
+	return dropped, err
+}
@@ -0,0 +1,178 @@
+package tailer_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/tailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitedWriter(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	testCases := []struct {
+		name            string
+		limits          *tailer.LogLimits
+		expectedDropped int64
+		expected        string
+	}{
+		{
+			name:     "unlimited",
+			expected: "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\nline 7\nline 8\nline 9\n",
+		},
+		{
+			name:     "under-limit",
+			limits:   tailer.NewLogLimits(1000, 0, 0, nil),
+			expected: "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\nline 7\nline 8\nline 9\n",
+		},
+		{
+			name:            "head-and-tail",
+			limits:          tailer.NewLogLimits(30, 14, 14, nil),
+			expectedDropped: 35,
+			expected:        "line 1\nline 2\n\n... [jx-test-collector] truncated 35 bytes of log output ...\n\nline 8\nline 9\n",
+		},
+		{
+			name:            "total",
+			limits:          tailer.NewLogLimits(0, 7, 7, &tailer.TotalLogBytes{MaxBytes: 20}),
+			expectedDropped: 49,
+			expected:        "line 1\n\n... [jx-test-collector] truncated 49 bytes of log output ...\n\nline 9\n",
+		},
+	}
+
+	for _, tc := range testCases {
+		fileName := filepath.Join(tmpDir, tc.name+".log")
+		file, err := os.Create(fileName)
+		require.NoError(t, err, "failed to create file %s", fileName)
+
+		w := tailer.NewLimitedWriter(file, tc.limits)
+		for i := 1; i <= 9; i++ {
+			_, err = w.Write([]byte(fmt.Sprintf("line %d\n", i)))
+			require.NoError(t, err, "failed to write line for %s", tc.name)
+		}
+		dropped, err := w.Close()
+		require.NoError(t, err, "failed to close writer for %s", tc.name)
+		require.NoError(t, file.Close(), "failed to close file %s", fileName)
+
+		data, err := ioutil.ReadFile(fileName)
+		require.NoError(t, err, "failed to load file %s", fileName)
+
+		assert.Equal(t, tc.expectedDropped, dropped, "dropped bytes for %s", tc.name)
+		assert.Equal(t, tc.expected, string(data), "log for %s", tc.name)
+		assert.Equal(t, tc.expectedDropped > 0, strings.Contains(string(data), "truncated"), "marker for %s", tc.name)
+	}
+}
+
+func TestLimitedWriterTail(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	fileName := filepath.Join(tmpDir, "tail.log")
+	file, err := os.Create(fileName)
+	require.NoError(t, err, "failed to create file %s", fileName)
+	defer file.Close()
+
+	w := tailer.NewLimitedWriter(file, tailer.NewLogLimits(30, 14, 14, nil))
+	for _, text := range []string{"line 1\nline 2\n", "line 3\nline 4\nline 5\nline 6\nline 7\nlin", "e 8\n", "line 9\n"} {
+		_, err = w.Write([]byte(text))
+		require.NoError(t, err, "failed to write %q", text)
+	}
+	assert.True(t, w.Truncated(), "truncated")
+
+	// a write larger than the tail only keeps its end
+	_, err = w.Write([]byte(strings.Repeat("x", 100) + "\nline 10\nline 11\n"))
+	require.NoError(t, err, "failed to write large text")
+
+	dropped, err := w.Close()
+	require.NoError(t, err, "failed to close writer")
+
+	data, err := ioutil.ReadFile(fileName)
+	require.NoError(t, err, "failed to load file %s", fileName)
+	assert.Equal(t, "line 1\nline 2\n\n... [jx-test-collector] truncated 158 bytes of log output ...\n\nline 11\n", string(data), "log")
+	assert.Equal(t, int64(158), dropped, "dropped bytes")
+}
+
+func TestLimitedWriterExistingContent(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	fileName := filepath.Join(tmpDir, "existing.log")
+	err = ioutil.WriteFile(fileName, []byte("line 1\nline 2\n"), 0600)
+	require.NoError(t, err, "failed to save file %s", fileName)
+
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND, 0600)
+	require.NoError(t, err, "failed to open file %s", fileName)
+	defer file.Close()
+
+	w := tailer.NewLimitedWriter(file, tailer.NewLogLimits(20, 10, 10, nil))
+	for i := 3; i <= 6; i++ {
+		_, err = w.Write([]byte(fmt.Sprintf("line %d\n", i)))
+		require.NoError(t, err, "failed to write line %d", i)
+	}
+	w.Marker = func(dropped int64) []byte {
+		return []byte(fmt.Sprintf("[dropped %d]\n", dropped))
+	}
+	dropped, err := w.Close()
+	require.NoError(t, err, "failed to close writer")
+
+	data, err := ioutil.ReadFile(fileName)
+	require.NoError(t, err, "failed to load file %s", fileName)
+	assert.Equal(t, "line 1\nline 2\n[dropped 21]\nline 6\n", string(data), "the existing content should be kept as the head")
+	assert.Equal(t, int64(21), dropped, "dropped bytes")
+}
+
+func TestTotalLogBytes(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	total := &tailer.TotalLogBytes{MaxBytes: 1 << 40}
+	limits := tailer.NewLogLimits(0, 0, 0, total)
+	assert.Equal(t, int64(tailer.DefaultTruncatedBytes), limits.HeadBytes, "head bytes should not depend on the total")
+	assert.Equal(t, int64(tailer.DefaultTruncatedBytes), limits.TailBytes, "tail bytes should not depend on the total")
+
+	total.MaxBytes = 30
+	limits = tailer.NewLogLimits(0, 7, 7, total)
+	writeLines := func(name string) string {
+		fileName := filepath.Join(tmpDir, name)
+		file, err := os.Create(fileName)
+		require.NoError(t, err, "failed to create file %s", fileName)
+		defer file.Close()
+
+		w := tailer.NewLimitedWriter(file, limits)
+		for i := 1; i <= 9; i++ {
+			_, err = w.Write([]byte(fmt.Sprintf("line %d\n", i)))
+			require.NoError(t, err, "failed to write line to %s", name)
+		}
+		_, err = w.Close()
+		require.NoError(t, err, "failed to close writer for %s", name)
+		return fileName
+	}
+
+	first := writeLines("first.log")
+	second := writeLines("second.log")
+	data, err := ioutil.ReadFile(second)
+	require.NoError(t, err, "failed to load file %s", second)
+	assert.Contains(t, string(data), "truncated 56 bytes", "the second log should be truncated once the total is exceeded")
+
+	total.Update()
+	assert.Equal(t, 2, total.Tracked(), "tracked files")
+
+	// lets simulate the logs being compressed and evicted
+	require.NoError(t, ioutil.WriteFile(first+".gz", []byte("gzip"), 0600), "failed to save compressed file")
+	require.NoError(t, os.Remove(first), "failed to remove %s", first)
+	require.NoError(t, os.Remove(second), "failed to remove %s", second)
+	total.Update()
+	assert.Equal(t, int64(4), total.Bytes(), "only the compressed file should be counted")
+	assert.Equal(t, 1, total.Tracked(), "tracked files")
+
+	third := writeLines("third.log")
+	data, err = ioutil.ReadFile(third)
+	require.NoError(t, err, "failed to load file %s", third)
+	assert.Equal(t, "line 1\n\n... [jx-test-collector] truncated 49 bytes of log output ...\n\nline 9\n", string(data), "the head should be written as the removed logs are no longer counted")
+}
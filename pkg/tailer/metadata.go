@@ -0,0 +1,225 @@
+package tailer
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
+	"github.com/jenkins-x/jx-test-collector/pkg/logfiles"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// MetadataFileName the name of the file in the pod log directory containing the pod metadata
+	MetadataFileName = logfiles.MetadataFileName
+)
+
+// PodMetadata the structured metadata of a pod and its terminated containers
+type PodMetadata struct {
+	Namespace  string              `json:"namespace"`
+	Name       string              `json:"name"`
+	Labels     map[string]string   `json:"labels,omitempty"`
+	Node       string              `json:"node,omitempty"`
+	Phase      corev1.PodPhase     `json:"phase,omitempty"`
+	Reason     string              `json:"reason,omitempty"`
+	Message    string              `json:"message,omitempty"`
+	StartTime  *metav1.Time        `json:"startTime,omitempty"`
+	Containers []ContainerMetadata `json:"containers"`
+}
+
+// ContainerMetadata the metadata of a container in a pod
+type ContainerMetadata struct {
+	Name         string              `json:"name"`
+	Init         bool                `json:"init,omitempty"`
+	Image        string              `json:"image,omitempty"`
+	ImageID      string              `json:"imageID,omitempty"`
+	RestartCount int32               `json:"restartCount"`
+	Requests     corev1.ResourceList `json:"requests,omitempty"`
+	Limits       corev1.ResourceList `json:"limits,omitempty"`
+	Terminated   bool                `json:"terminated"`
+	ExitCode     int32               `json:"exitCode"`
+	Signal       int32               `json:"signal,omitempty"`
+	Reason       string              `json:"reason,omitempty"`
+	Message      string              `json:"message,omitempty"`
+	StartedAt    *metav1.Time        `json:"startedAt,omitempty"`
+	FinishedAt   *metav1.Time        `json:"finishedAt,omitempty"`
+
+	// TruncatedBytes the number of bytes dropped from the log file due to the log size limits
+	TruncatedBytes int64 `json:"truncatedBytes,omitempty"`
+}
+
+// NewPodMetadata creates the metadata for the given pod, masking any termination messages
+func NewPodMetadata(pod *corev1.Pod, mask func(string) string) *PodMetadata {
+	m := &PodMetadata{
+		Namespace: pod.Namespace,
+		Name:      pod.Name,
+		Labels:    pod.Labels,
+		Node:      pod.Spec.NodeName,
+		Phase:     pod.Status.Phase,
+		Reason:    pod.Status.Reason,
+		Message:   mask(pod.Status.Message),
+		StartTime: pod.Status.StartTime,
+	}
+	m.addContainers(pod.Spec.InitContainers, pod.Status.InitContainerStatuses, true, mask)
+	m.addContainers(pod.Spec.Containers, pod.Status.ContainerStatuses, false, mask)
+	return m
+}
+
+func (m *PodMetadata) addContainers(containers []corev1.Container, statuses []corev1.ContainerStatus, init bool, mask func(string) string) {
+	for i := range statuses {
+		s := &statuses[i]
+		c := ContainerMetadata{
+			Name:         s.Name,
+			Init:         init,
+			Image:        s.Image,
+			ImageID:      s.ImageID,
+			RestartCount: s.RestartCount,
+		}
+		for j := range containers {
+			if containers[j].Name == s.Name {
+				c.Requests = containers[j].Resources.Requests
+				c.Limits = containers[j].Resources.Limits
+				break
+			}
+		}
+
+		t := s.State.Terminated
+		if t == nil {
+			t = s.LastTerminationState.Terminated
+		} else {
+			c.Terminated = true
+		}
+		if t != nil {
+			c.ExitCode = t.ExitCode
+			c.Signal = t.Signal
+			c.Reason = t.Reason
+			c.Message = mask(t.Message)
+			c.StartedAt = timePtr(t.StartedAt)
+			c.FinishedAt = timePtr(t.FinishedAt)
+		}
+		m.Containers = append(m.Containers, c)
+	}
+}
+
+// HasTerminated returns true if any of the containers have terminated
+func (m *PodMetadata) HasTerminated() bool {
+	for i := range m.Containers {
+		if m.Containers[i].Terminated || m.Containers[i].RestartCount > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// savePodMetadata writes the metadata file into the pod log directory if any containers have terminated
+func (o *Options) savePodMetadata(pod *corev1.Pod, path string) error {
+	m := NewPodMetadata(pod, o.mask)
+	if !m.HasTerminated() {
+		return nil
+	}
+
+	o.metadataLock.Lock()
+	defer o.metadataLock.Unlock()
+
+	// lets keep the truncations recorded in the existing file unless it cannot be parsed
+	truncations := map[string]int64{}
+	existing, err := o.loadPodMetadata(path)
+	if err == nil {
+		for _, c := range existing.Containers {
+			truncations[c.Name] = c.TruncatedBytes
+		}
+	}
+	for i := range m.Containers {
+		c := &m.Containers[i]
+		c.TruncatedBytes = truncations[c.Name]
+	}
+	return o.writePodMetadata(m, path)
+}
+
+// saveTruncation records the number of bytes dropped from the log of the target container in the metadata file
+func (o *Options) saveTruncation(target *Target, dropped int64) error {
+	o.metadataLock.Lock()
+	defer o.metadataLock.Unlock()
+
+	m, err := o.loadPodMetadata(target.Path)
+	if err != nil {
+		return err
+	}
+	m.Namespace = target.Namespace
+	m.Name = target.Pod
+
+	found := false
+	for i := range m.Containers {
+		if m.Containers[i].Name == target.Container {
+			m.Containers[i].TruncatedBytes = dropped
+			found = true
+		}
+	}
+	if !found {
+		m.Containers = append(m.Containers, ContainerMetadata{
+			Name:           target.Container,
+			TruncatedBytes: dropped,
+		})
+	}
+	return o.writePodMetadata(m, target.Path)
+}
+
+// loadPodMetadata loads the metadata file in the pod log directory returning empty metadata if there is no file
+func (o *Options) loadPodMetadata(path string) (*PodMetadata, error) {
+	m := &PodMetadata{}
+	fileName := filepath.Join(o.Dir, o.LogPath, path, MetadataFileName)
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return m, nil
+	}
+	err = json.Unmarshal(data, m)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse file %s", fileName)
+	}
+	return m, nil
+}
+
+func (o *Options) writePodMetadata(m *PodMetadata, path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal metadata for pod %s", m.Name)
+	}
+
+	dir := filepath.Join(o.Dir, o.LogPath, path)
+	fileName := filepath.Join(dir, MetadataFileName)
+
+	// lets avoid rewriting the file on every pod modification
+	existing, err := ioutil.ReadFile(fileName)
+	if err == nil && bytes.Equal(existing, data) {
+		return nil
+	}
+
+	err = os.MkdirAll(dir, files.DefaultDirWritePermissions)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create directory %s", dir)
+	}
+	err = ioutil.WriteFile(fileName, data, files.DefaultFileWritePermissions)
+	if err != nil {
+		return errors.Wrapf(err, "failed to save file %s", fileName)
+	}
+	return nil
+}
+
+func (o *Options) mask(text string) string {
+	if o.Masker == nil {
+		return text
+	}
+	return o.Masker.Mask(text)
+}
+
+func timePtr(t metav1.Time) *metav1.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,199 @@
+package tailer_test
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/masker"
+	"github.com/jenkins-x/jx-test-collector/pkg/tailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newMetadataPod() *corev1.Pod {
+	started := metav1.NewTime(time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC))
+	finished := metav1.NewTime(started.Add(time.Minute))
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mypod",
+			Namespace: "jx",
+			Labels:    map[string]string{"app": "myapp"},
+		},
+		Spec: corev1.PodSpec{
+			NodeName: "mynode",
+			InitContainers: []corev1.Container{
+				{Name: "prepare"},
+			},
+			Containers: []corev1.Container{
+				{
+					Name: "step-build",
+					Resources: corev1.ResourceRequirements{
+						Requests: corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("128Mi")},
+						Limits:   corev1.ResourceList{corev1.ResourceMemory: resource.MustParse("256Mi")},
+					},
+				},
+				{Name: "sidecar"},
+			},
+		},
+		Status: corev1.PodStatus{
+			Phase: corev1.PodFailed,
+			InitContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name: "prepare",
+					State: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{ExitCode: 0, Reason: "Completed", StartedAt: started, FinishedAt: finished},
+					},
+				},
+			},
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name:  "step-build",
+					Image: "myimage:1.0.0",
+					State: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{
+							ExitCode:   137,
+							Signal:     9,
+							Reason:     "OOMKilled",
+							Message:    "failed with token s3cr3tvalue",
+							StartedAt:  started,
+							FinishedAt: finished,
+						},
+					},
+				},
+				{
+					Name:         "sidecar",
+					RestartCount: 1,
+					State: corev1.ContainerState{
+						Running: &corev1.ContainerStateRunning{StartedAt: finished},
+					},
+					LastTerminationState: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"},
+					},
+				},
+			},
+		},
+	}
+}
+
+func maskSecret(text string) string {
+	m := &masker.Client{ReplaceWords: map[string]string{"s3cr3tvalue": "****"}}
+	return m.Mask(text)
+}
+
+func TestNewPodMetadata(t *testing.T) {
+	m := tailer.NewPodMetadata(newMetadataPod(), maskSecret)
+
+	assert.Equal(t, "jx", m.Namespace, "namespace")
+	assert.Equal(t, "mynode", m.Node, "node")
+	assert.Equal(t, corev1.PodFailed, m.Phase, "phase")
+	require.Len(t, m.Containers, 3, "containers")
+
+	initContainer := m.Containers[0]
+	assert.Equal(t, "prepare", initContainer.Name, "init container name")
+	assert.True(t, initContainer.Init, "init container")
+	assert.True(t, initContainer.Terminated, "init container terminated")
+	assert.Equal(t, "Completed", initContainer.Reason, "init container reason")
+	require.NotNil(t, initContainer.FinishedAt, "init container finished")
+
+	build := m.Containers[1]
+	assert.False(t, build.Init, "build container is not an init container")
+	assert.True(t, build.Terminated, "build container terminated")
+	assert.Equal(t, int32(137), build.ExitCode, "exit code")
+	assert.Equal(t, int32(9), build.Signal, "signal")
+	assert.Equal(t, "OOMKilled", build.Reason, "reason")
+	assert.Equal(t, "failed with token ****", build.Message, "masked message")
+	assert.Equal(t, "myimage:1.0.0", build.Image, "image")
+	assert.Equal(t, "256Mi", build.Limits.Memory().String(), "memory limit")
+	assert.Equal(t, "128Mi", build.Requests.Memory().String(), "memory request")
+
+	sidecar := m.Containers[2]
+	assert.False(t, sidecar.Terminated, "restarted container is running")
+	assert.Equal(t, int32(1), sidecar.ExitCode, "exit code of the last termination")
+	assert.Equal(t, "Error", sidecar.Reason, "reason of the last termination")
+	assert.Nil(t, sidecar.StartedAt, "zero times are omitted")
+}
+
+func TestHasTerminated(t *testing.T) {
+	pod := newMetadataPod()
+	assert.True(t, tailer.NewPodMetadata(pod, maskSecret).HasTerminated(), "terminated pod")
+
+	pod.Status.InitContainerStatuses = nil
+	pod.Status.ContainerStatuses = []corev1.ContainerStatus{
+		{
+			Name:  "step-build",
+			State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+		},
+	}
+	assert.False(t, tailer.NewPodMetadata(pod, maskSecret).HasTerminated(), "running pod")
+
+	pod.Status.ContainerStatuses[0].RestartCount = 2
+	assert.True(t, tailer.NewPodMetadata(pod, maskSecret).HasTerminated(), "restarted pod")
+}
+
+func TestSavePodMetadata(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	kubeClient := fake.NewSimpleClientset()
+	o := &tailer.Options{
+		Dir:     tmpDir,
+		LogPath: "logs",
+		Masker: &masker.Client{
+			ReplaceWords: map[string]string{"s3cr3tvalue": "****"},
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pods := kubeClient.CoreV1().Pods("jx")
+	added, _, err := o.Watch(ctx, pods, labels.Everything())
+	require.NoError(t, err, "failed to watch pods")
+	go func() {
+		for range added {
+		}
+	}()
+
+	running := newMetadataPod()
+	running.Name = "running"
+	running.Status.InitContainerStatuses = nil
+	running.Status.ContainerStatuses = nil
+	_, err = pods.Create(ctx, running, metav1.CreateOptions{})
+	require.NoError(t, err, "failed to create pod")
+
+	// lets simulate the truncation of a log being recorded before the pod terminates
+	fileName := filepath.Join(tmpDir, "logs", "jx", "myapp", "mypod", tailer.MetadataFileName)
+	err = os.MkdirAll(filepath.Dir(fileName), 0700)
+	require.NoError(t, err, "failed to create dir for %s", fileName)
+	err = ioutil.WriteFile(fileName, []byte(`{"name":"mypod","containers":[{"name":"step-build","truncatedBytes":100}]}`), 0600)
+	require.NoError(t, err, "failed to save file %s", fileName)
+
+	_, err = pods.Create(ctx, newMetadataPod(), metav1.CreateOptions{})
+	require.NoError(t, err, "failed to create pod")
+
+	require.Eventually(t, func() bool {
+		m := &tailer.PodMetadata{}
+		data, err := ioutil.ReadFile(fileName)
+		return err == nil && json.Unmarshal(data, m) == nil && len(m.Containers) == 3
+	}, 5*time.Second, 10*time.Millisecond, "should save %s", fileName)
+
+	data, err := ioutil.ReadFile(fileName)
+	require.NoError(t, err, "failed to load %s", fileName)
+	m := &tailer.PodMetadata{}
+	err = json.Unmarshal(data, m)
+	require.NoError(t, err, "failed to parse %s", fileName)
+	require.Len(t, m.Containers, 3, "containers")
+	assert.Equal(t, "failed with token ****", m.Containers[1].Message, "masked message")
+	assert.Equal(t, int64(100), m.Containers[1].TruncatedBytes, "the recorded truncation should be kept")
+	assert.NotContains(t, string(data), "s3cr3tvalue", "secrets should be masked")
+
+	assert.NoFileExists(t, filepath.Join(tmpDir, "logs", "jx", "myapp", "running", tailer.MetadataFileName), "running pods have no metadata")
+}
@@ -0,0 +1,117 @@
+package tailer
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultMultilineContinuation matches the lines which continue the previous record such as indented lines,
+	// Java stack frames and causes and the goroutines and frames of Go panics
+	DefaultMultilineContinuation = `^[ \t]+\S|^Caused by: |^goroutine \d+ \[|^created by |^[\w./\-]+\.[\w.$()*\-]+\(.*\)$`
+
+	// DefaultMultilineMaxLines the default maximum number of lines in a record
+	DefaultMultilineMaxLines = 500
+
+	// DefaultMultilineFlushDelay the default time a pending record is held without any new lines before it is written
+	DefaultMultilineFlushDelay = time.Second
+)
+
+// MultilineOptions configures how lines are grouped into records such as stack traces so that
+// the include and exclude filters apply to whole records rather than individual lines
+type MultilineOptions struct {
+	// Continuation matches the lines which are appended to the previous record.
+	// Blank lines are appended if they are followed by a continuation line
+	Continuation *regexp.Regexp
+
+	// MaxLines the maximum number of lines in a record
+	MaxLines int
+
+	// FlushDelay how long a pending record is held without any new lines before it is written so that the
+	// last record is not lost if the container hangs. Defaults to DefaultMultilineFlushDelay
+	FlushDelay time.Duration
+}
+
+// NewMultilineOptions creates the multiline options for the continuation regular expression
+// which defaults to DefaultMultilineContinuation
+func NewMultilineOptions(continuation string) (*MultilineOptions, error) {
+	if continuation == "" {
+		continuation = DefaultMultilineContinuation
+	}
+	r, err := regexp.Compile(continuation)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse multiline continuation regex %s", continuation)
+	}
+	return &MultilineOptions{
+		Continuation: r,
+		MaxLines:     DefaultMultilineMaxLines,
+		FlushDelay:   DefaultMultilineFlushDelay,
+	}, nil
+}
+
+// LineGrouper groups the lines of a container log into records
+type LineGrouper struct {
+	Options *MultilineOptions
+
+	record []*Line
+	blanks []*Line
+}
+
+// Add adds the next line returning any records which are now complete
+func (g *LineGrouper) Add(l *Line) [][]*Line {
+	if strings.TrimSpace(l.Message) == "" {
+		// lets wait for the next line to know if the blank line is part of the record
+		g.blanks = append(g.blanks, l)
+		return nil
+	}
+	maxLines := g.Options.MaxLines
+	if maxLines <= 0 {
+		maxLines = DefaultMultilineMaxLines
+	}
+
+	var answer [][]*Line
+	continues := len(g.record) > 0 && g.Options.Continuation.MatchString(l.Message) &&
+		len(g.record)+len(g.blanks) < maxLines
+	if continues {
+		g.record = append(g.record, g.blanks...)
+	} else {
+		answer = g.Flush()
+	}
+	g.blanks = nil
+	g.record = append(g.record, l)
+	return answer
+}
+
+// Pending returns true if there are lines which have not been returned as records yet
+func (g *LineGrouper) Pending() bool {
+	return len(g.record) > 0 || len(g.blanks) > 0
+}
+
+// Flush returns the pending records
+func (g *LineGrouper) Flush() [][]*Line {
+	var answer [][]*Line
+	if len(g.record) > 0 {
+		answer = append(answer, g.record)
+	}
+	for _, l := range g.blanks {
+		answer = append(answer, []*Line{l})
+	}
+	g.record = nil
+	g.blanks = nil
+	return answer
+}
+
+// RecordText returns the text of a record for filtering
+func RecordText(record []*Line) string {
+	if len(record) == 1 {
+		return record[0].Message
+	}
+	lines := make([]string, 0, len(record))
+	for _, l := range record {
+		lines = append(lines, l.Message)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,148 @@
+package tailer_test
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/masker"
+	"github.com/jenkins-x/jx-test-collector/pkg/tailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultilineFiltering(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	multiline, err := tailer.NewMultilineOptions("")
+	require.NoError(t, err, "failed to create multiline options")
+
+	lines := []string{
+		"starting tests",
+		"panic: boom",
+		"",
+		"goroutine 1 [running]:",
+		"main.main()",
+		"\t/workspace/source/main.go:12 +0x25",
+		"exit status 2",
+		"",
+		"Exception in thread \"main\" java.lang.IllegalStateException: boom",
+		"\tat com.example.Main.run(Main.java:10)",
+		"Caused by: java.io.IOException: disk full",
+		"\t... 3 more",
+		"done",
+	}
+
+	testCases := []struct {
+		name     string
+		include  string
+		exclude  string
+		expected []string
+	}{
+		{
+			name:     "go-panic",
+			include:  "panic:",
+			expected: lines[1:6],
+		},
+		{
+			name:     "java-cause",
+			include:  "IOException",
+			expected: lines[8:12],
+		},
+		{
+			name:     "exclude-stack-traces",
+			exclude:  "panic:|Exception",
+			expected: []string{"starting tests", "exit status 2", "", "done"},
+		},
+	}
+
+	for _, tc := range testCases {
+		options := &tailer.TailOptions{Multiline: multiline}
+		if tc.include != "" {
+			options.Include = append(options.Include, regexp.MustCompile(tc.include))
+		}
+		if tc.exclude != "" {
+			options.Exclude = append(options.Exclude, regexp.MustCompile(tc.exclude))
+		}
+		tail := tailer.NewTail(nil, tmpDir, "jx", "mypod", "step-test", nil, options)
+
+		grouper := &tailer.LineGrouper{Options: multiline}
+		var records [][]*tailer.Line
+		for _, text := range lines {
+			records = append(records, grouper.Add(tail.NewLine(text+"\n"))...)
+		}
+		records = append(records, grouper.Flush()...)
+
+		var actual []string
+		for _, record := range records {
+			text := tailer.RecordText(record)
+			if tail.Matches(text) {
+				actual = append(actual, strings.Split(text, "\n")...)
+			}
+		}
+		assert.Equal(t, tc.expected, actual, "filtered lines for %s", tc.name)
+	}
+}
+
+func TestMultilineIdleFlush(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	multiline, err := tailer.NewMultilineOptions("")
+	require.NoError(t, err, "failed to create multiline options")
+	multiline.FlushDelay = 50 * time.Millisecond
+
+	tail := tailer.NewTail(&masker.Client{}, tmpDir, "jx", "mypod", "step-test", nil, &tailer.TailOptions{Multiline: multiline})
+
+	logReader, logWriter := io.Pipe()
+	outReader, outWriter := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		writer := bufio.NewWriter(outWriter)
+		tail.ReadLines(logReader, writer)
+		writer.Flush()
+		outWriter.Close()
+		close(done)
+	}()
+
+	lines := make(chan string)
+	go func() {
+		reader := bufio.NewReader(outReader)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				close(lines)
+				return
+			}
+			lines <- line
+		}
+	}()
+
+	// the container hangs after the panic so the record is written once the log is quiet
+	_, err = io.WriteString(logWriter, "panic: boom\n\ngoroutine 1 [running]:\n")
+	require.NoError(t, err, "failed to write log")
+	for _, expected := range []string{"panic: boom\n", "\n", "goroutine 1 [running]:\n"} {
+		select {
+		case line := <-lines:
+			assert.Equal(t, expected, line, "flushed line")
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "the pending record was not flushed", "expected %q", expected)
+		}
+	}
+
+	_, err = io.WriteString(logWriter, "done\n")
+	require.NoError(t, err, "failed to write log")
+	logWriter.Close()
+
+	var remaining []string
+	for line := range lines {
+		remaining = append(remaining, line)
+	}
+	assert.Equal(t, []string{"done\n"}, remaining, "remaining lines")
+	<-done
+}
@@ -0,0 +1,117 @@
+package tailer
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// NDJSONExtension the file extension of the newline delimited JSON container logs
+	NDJSONExtension = ".ndjson"
+
+	// StreamCombined the stream of lines from the kubernetes logs API which interleaves stdout and stderr
+	StreamCombined = "combined"
+)
+
+// Record a line of a container log in the NDJSON output
+type Record struct {
+	Timestamp time.Time `json:"timestamp"`
+	Namespace string    `json:"namespace"`
+	Pod       string    `json:"pod"`
+	Container string    `json:"container"`
+
+	// Stream the stream of the line; the kubernetes logs API interleaves stdout and stderr so this is always combined
+	Stream  string `json:"stream"`
+	Message string `json:"message"`
+
+	// Fields the parsed fields if the message is itself a JSON object
+	Fields map[string]interface{} `json:"fields,omitempty"`
+}
+
+// ndjsonOutput writes each line as a JSON record
+type ndjsonOutput struct {
+	file    *os.File
+	limited *LimitedWriter
+	writer  *bufio.Writer
+	encoder *json.Encoder
+	last    Record
+}
+
+// NewNDJSONOutput creates an output writing newline delimited JSON records to the given file with the given
+// limits which may be nil. If the file is truncated the marker is written as a record
+func NewNDJSONOutput(fileName string, limits *LogLimits) (Output, error) {
+	file, err := os.Create(fileName)
+	if err != nil {
+		return nil, err
+	}
+	o := &ndjsonOutput{
+		file:    file,
+		limited: NewLimitedWriter(file, limits),
+	}
+	o.limited.Marker = o.marker
+	o.writer = bufio.NewWriter(o.limited)
+	o.encoder = json.NewEncoder(o.writer)
+	o.encoder.SetEscapeHTML(false)
+	return o, nil
+}
+
+// Write writes the line as a JSON record
+func (o *ndjsonOutput) Write(line *Line) {
+	r := &Record{
+		Timestamp: line.Timestamp,
+		Namespace: line.Namespace,
+		Pod:       line.Pod,
+		Container: line.Container,
+		Stream:    StreamCombined,
+		Message:   line.Message,
+	}
+	text := strings.TrimSpace(line.Message)
+	if strings.HasPrefix(text, "{") && strings.HasSuffix(text, "}") {
+		fields := map[string]interface{}{}
+		if json.Unmarshal([]byte(text), &fields) == nil {
+			r.Fields = fields
+		}
+	}
+	o.last = *r
+	err := o.encoder.Encode(r)
+	if err != nil {
+		logrus.WithError(err).Debugf("failed to write NDJSON record to %s", o.file.Name())
+		return
+	}
+	o.writer.Flush()
+}
+
+// Close writes the tail of a truncated file and closes the file
+func (o *ndjsonOutput) Close() {
+	o.writer.Flush()
+	dropped, err := o.limited.Close()
+	if err != nil {
+		logrus.WithError(err).Warnf("failed to write the tail of the truncated file %s", o.file.Name())
+	}
+	if dropped > 0 {
+		logrus.Infof("truncated %d bytes of %s", dropped, o.file.Name())
+	}
+	o.file.Close()
+}
+
+// marker returns the record written between the head and tail of a truncated file
+func (o *ndjsonOutput) marker(dropped int64) []byte {
+	r := &Record{
+		Timestamp: o.last.Timestamp,
+		Namespace: o.last.Namespace,
+		Pod:       o.last.Pod,
+		Container: o.last.Container,
+		Stream:    StreamCombined,
+		Message:   strings.TrimSpace(string(TruncatedMarker(dropped))),
+	}
+	data, err := json.Marshal(r)
+	if err != nil {
+		return TruncatedMarker(dropped)
+	}
+	return append(data, '\n')
+}
@@ -0,0 +1,137 @@
+package tailer_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/tailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNDJSONOutput(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	fileName := filepath.Join(tmpDir, "step-build"+tailer.NDJSONExtension)
+	output, err := tailer.NewNDJSONOutput(fileName, nil)
+	require.NoError(t, err, "failed to create NDJSON output")
+
+	start := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	messages := []string{
+		"compiling",
+		`{"level":"info","msg":"built","count":3,"tags":["a","b"]}`,
+		`  {"level":"warn"}  `,
+		"{not json}",
+		`["a", "b"]`,
+		"",
+	}
+	for i, m := range messages {
+		output.Write(&tailer.Line{
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+			Namespace: "jx",
+			Pod:       "mypod",
+			Container: "step-build",
+			Message:   m,
+		})
+	}
+	output.Close()
+
+	f, err := os.Open(fileName)
+	require.NoError(t, err, "failed to open file %s", fileName)
+	defer f.Close()
+
+	var lines []string
+	var records []*tailer.Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		r := &tailer.Record{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), r), "failed to parse record %s", scanner.Text())
+		records = append(records, r)
+	}
+	require.NoError(t, scanner.Err(), "failed to read file %s", fileName)
+	require.Len(t, records, len(messages), "records")
+
+	// lets check the shape of a record
+	assert.Equal(t, `{"timestamp":"2021-06-01T10:00:00Z","namespace":"jx","pod":"mypod","container":"step-build","stream":"combined","message":"compiling"}`, lines[0], "record")
+
+	for i, r := range records {
+		assert.Equal(t, start.Add(time.Duration(i)*time.Second), r.Timestamp.UTC(), "timestamp of record %d", i)
+		assert.Equal(t, "jx", r.Namespace, "namespace of record %d", i)
+		assert.Equal(t, "mypod", r.Pod, "pod of record %d", i)
+		assert.Equal(t, "step-build", r.Container, "container of record %d", i)
+		assert.Equal(t, tailer.StreamCombined, r.Stream, "stream of record %d", i)
+		assert.Equal(t, messages[i], r.Message, "message of record %d", i)
+	}
+
+	// JSON objects are parsed into fields
+	assert.Equal(t, map[string]interface{}{
+		"level": "info",
+		"msg":   "built",
+		"count": float64(3),
+		"tags":  []interface{}{"a", "b"},
+	}, records[1].Fields, "fields of a JSON message")
+	assert.Equal(t, map[string]interface{}{"level": "warn"}, records[2].Fields, "fields of a JSON message with whitespace")
+
+	// other lines have no fields
+	for _, i := range []int{0, 3, 4, 5} {
+		assert.Nil(t, records[i].Fields, "fields of non JSON object message %q", messages[i])
+		assert.NotContains(t, lines[i], `"fields"`, "record of non JSON object message %q", messages[i])
+	}
+}
+
+func TestNDJSONOutputLimits(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	fileName := filepath.Join(tmpDir, "step-build"+tailer.NDJSONExtension)
+	output, err := tailer.NewNDJSONOutput(fileName, tailer.NewLogLimits(500, 250, 250, nil))
+	require.NoError(t, err, "failed to create NDJSON output")
+
+	start := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		output.Write(&tailer.Line{
+			Timestamp: start.Add(time.Duration(i) * time.Second),
+			Namespace: "jx",
+			Pod:       "mypod",
+			Container: "step-build",
+			Message:   fmt.Sprintf("line %d", i),
+		})
+	}
+	output.Close()
+
+	f, err := os.Open(fileName)
+	require.NoError(t, err, "failed to open file %s", fileName)
+	defer f.Close()
+
+	var records []*tailer.Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		r := &tailer.Record{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), r), "every line of a truncated file should be a record: %s", scanner.Text())
+		records = append(records, r)
+	}
+	require.NoError(t, scanner.Err(), "failed to read file %s", fileName)
+	require.True(t, len(records) > 2 && len(records) < 20, "the file should be truncated but has %d records", len(records))
+
+	assert.Equal(t, "line 0", records[0].Message, "first record")
+	assert.Equal(t, "line 19", records[len(records)-1].Message, "last record")
+
+	found := false
+	for _, r := range records {
+		if strings.Contains(r.Message, "[jx-test-collector] truncated") {
+			found = true
+			assert.Equal(t, "mypod", r.Pod, "pod of the marker")
+			assert.Equal(t, "step-build", r.Container, "container of the marker")
+		}
+	}
+	assert.True(t, found, "should contain the truncation marker record")
+}
@@ -5,18 +5,27 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"regexp"
+	"strings"
+	"sync"
 	"text/template"
 	"time"
 
 	"github.com/jenkins-x-plugins/jx-secret/pkg/masker"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/kube"
+	"github.com/jenkins-x/jx-test-collector/pkg/diskguard"
+	"github.com/jenkins-x/jx-test-collector/pkg/flaky"
 	"github.com/jenkins-x/jx-test-collector/pkg/gitstore"
+	"github.com/jenkins-x/jx-test-collector/pkg/logfiles"
+	"github.com/jenkins-x/jx-test-collector/pkg/metrics"
 	"github.com/jenkins-x/jx-test-collector/pkg/resources"
+	"github.com/jenkins-x/jx-test-collector/pkg/search"
+	"github.com/jenkins-x/jx-test-collector/pkg/testresults"
 	"github.com/jenkins-x/jx-test-collector/pkg/web"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes"
 )
 
@@ -28,9 +37,18 @@ type Options struct {
 	// Resources for dumping kubernetes resources
 	Resources resources.Options
 
+	// Flaky generates the flaky tests reports
+	Flaky flaky.Options
+
 	// GitStore takes care of storing files in git
 	GitStore gitstore.Options
 
+	// Disk monitors the disk usage of the work directory
+	Disk diskguard.Options
+
+	// Health tracks the background work for the readiness and liveness checks
+	Health Health
+
 	// Dir is the work directory. If not specified a temporary directory is created on startup.
 	Dir string `env:"WORK_DIR"`
 
@@ -40,6 +58,25 @@ type Options struct {
 	// ResourcePath the path within Dir where we store resources
 	ResourcePath string `env:"RESOURCE_PATH,default=resources"`
 
+	// Layout the layout of the log directory: either 'app' to group pods by namespace and app or 'pipelinerun'
+	// to group the pods of a tekton pipeline run by owner, repository, branch and build
+	Layout string `env:"LAYOUT,default=app"`
+
+	// PodPathTemplate the go template evaluated against each pod to create the path of its log directory.
+	// The template can use the Name, Namespace, Labels, Annotations and OwnerReferences of the pod.
+	//
+	// Defaults to pathtemplate.DefaultPodPathTemplate which uses namespace/app/pod
+	PodPathTemplate string `env:"POD_PATH_TEMPLATE"`
+
+	// RunPathTemplate the go template evaluated against each pod to create the path of the directory for the
+	// files of its pipeline run such as test results.
+	//
+	// Defaults to pathtemplate.DefaultRunPathTemplate which uses namespace/app/pipelineRun
+	RunPathTemplate string `env:"RUN_PATH_TEMPLATE"`
+
+	// ReportPath the path within Dir where we store reports such as flaky tests
+	ReportPath string `env:"REPORT_PATH,default=reports"`
+
 	// Namespace the namespace polled. Defaults to all of them
 	Namespace string `env:"NAMESPACE"`
 
@@ -49,12 +86,84 @@ type Options struct {
 	// SyncDuration duration between syncs
 	SyncDuration time.Duration `env:"SYNC_DURATION"`
 
+	// NoCompletionSync disables syncing when a tekton pipeline pod or PipelineActivity completes
+	// so that only the periodic syncs are performed
+	NoCompletionSync bool `env:"NO_COMPLETION_SYNC"`
+
+	// CompletionSyncDelay how long to wait after the last completed pipeline before syncing so that
+	// the logs are written and a burst of completions results in a single sync
+	CompletionSyncDelay time.Duration `env:"COMPLETION_SYNC_DELAY,default=30s"`
+
+	// CompletionSyncMaxDelay the maximum time to wait after a completed pipeline before syncing
+	// while other pipelines continue to complete
+	CompletionSyncMaxDelay time.Duration `env:"COMPLETION_SYNC_MAX_DELAY,default=2m"`
+
 	// NoLoop disable the polling loop so that a single poll is performed only
 	NoLoop bool `env:"NO_LOOP"`
 
 	// NoResourceApply disable the applying of resources in a git repository at `.jx/git-operator/resources/*.yaml`
 	NoResourceApply bool `env:"NO_RESOURCE_APPLY"`
 
+	// LineTemplate the go template used to format each line of the container logs. The template can use the
+	// Timestamp, Namespace, Pod, Container and Message of the line. e.g.
+	//
+	//   {{ .Timestamp.Format "15:04:05" }} {{ .Pod }} {{ .Container }} {{ .Message }}
+	//
+	// If not specified the message is written as is
+	LineTemplate string `env:"LINE_TEMPLATE"`
+
+	// SanitizeLogs removes ANSI colour codes and collapses carriage return progress output in the logs
+	SanitizeLogs bool `env:"SANITIZE_LOGS"`
+
+	// Multiline enables grouping lines such as stack traces into records so that the include and exclude
+	// filters apply to whole records
+	Multiline bool `env:"MULTILINE"`
+
+	// MultilineContinuation the regular expression matching lines which continue the previous record.
+	// Defaults to DefaultMultilineContinuation which matches indented lines and Java and Go stack traces
+	MultilineContinuation string `env:"MULTILINE_CONTINUATION"`
+
+	// MultilineFlushDelay how long a pending multiline record is held without any new lines before it is written
+	MultilineFlushDelay time.Duration `env:"MULTILINE_FLUSH_DELAY,default=1s"`
+
+	// SearchMaxLines the maximum number of the most recent log lines kept in the search index. Zero disables search
+	SearchMaxLines int `env:"SEARCH_MAX_LINES,default=200000"`
+
+	// NDJSON enables writing each container log as newline delimited JSON records alongside the .log file
+	NDJSON bool `env:"NDJSON"`
+
+	// CompressLogs enables gzipping the log files of terminated containers
+	CompressLogs bool `env:"COMPRESS_LOGS"`
+
+	// CompressMinBytes the minimum size of a terminated container log file before it is compressed
+	CompressMinBytes int64 `env:"COMPRESS_MIN_BYTES,default=65536"`
+
+	// MaxLogBytes the maximum size of each container log file, NDJSON file and combined log. Larger logs are
+	// truncated keeping the head and tail and only this many bytes of each container log are searchable
+	MaxLogBytes int64 `env:"MAX_LOG_BYTES"`
+
+	// LogHeadBytes the number of bytes at the start of a truncated log to keep. Defaults to half of the maximum size
+	// or 256KiB if only the total size is limited
+	LogHeadBytes int64 `env:"LOG_HEAD_BYTES"`
+
+	// LogTailBytes the number of bytes at the end of a truncated log to keep. Defaults to half of the maximum size
+	// or 256KiB if only the total size is limited
+	LogTailBytes int64 `env:"LOG_TAIL_BYTES"`
+
+	// MaxTotalLogBytes the maximum size of all the container logs, NDJSON files and combined logs written by this process.
+	// Once exceeded logs are truncated as they are written. The size is recomputed from disk after each sync so that
+	// compressed, evicted and deleted logs are no longer counted
+	MaxTotalLogBytes int64 `env:"MAX_TOTAL_LOG_BYTES"`
+
+	// NoCombinedLogs disables the writing of the combined logs of all the containers in each pod and pipeline run
+	NoCombinedLogs bool `env:"NO_COMBINED_LOGS"`
+
+	// StreamRetention how long a finished container log is listed and served by the web server if its pod is not deleted
+	StreamRetention time.Duration `env:"STREAM_RETENTION,default=1h"`
+
+	// NoEvents disables the collecting of kubernetes events for pods and other resources
+	NoEvents bool `env:"NO_EVENTS"`
+
 	// KubeClient is used to lazy create the repo client and launcher
 	KubeClient kubernetes.Interface
 
@@ -69,6 +178,28 @@ type Options struct {
 	LabelSelector labels.Selector
 	TailLines     *int64
 	Template      *template.Template
+
+	tests        *TestCollector
+	events       *EventCollector
+	combined     *CombinedLogs
+	podLayout    Layout
+	metadataLock sync.Mutex
+	totalLogs    *TotalLogBytes
+	activePods   ActivePods
+	multiline    *MultilineOptions
+	streams      LogStreams
+	search       *search.Index
+	completions  *completions
+	syncLock     sync.Mutex
+	syncing      *syncCall
+	syncPending  *syncCall
+}
+
+// syncCall a sync whose result is shared by all the callers of DoSync waiting for it
+type syncCall struct {
+	done   chan struct{}
+	record *web.SyncRecord
+	err    error
 }
 
 // Run polls for git changes
@@ -78,11 +209,7 @@ func (o *Options) Run() error {
 		return errors.Wrap(err, "invalid options")
 	}
 
-	err = o.GitStore.Setup()
-	if err != nil {
-		return errors.Wrapf(err, "failed to setup git store")
-	}
-
+	// lets serve the health checks while the git store is cloned so that the pod is not ready until it is set up
 	go func() {
 		err := o.Web.Run()
 		if err != nil {
@@ -90,18 +217,28 @@ func (o *Options) Run() error {
 		}
 	}()
 
+	err = o.GitStore.Setup()
+	if err != nil {
+		return errors.Wrapf(err, "failed to setup git store")
+	}
+	o.Health.SetupDone()
+
 	ticker := time.NewTicker(o.SyncDuration)
 	quit := make(chan struct{})
 	go func() {
+		o.Health.LoopTick()
+		o.Web.History.SetNextSync(time.Now().Add(o.SyncDuration))
 		for {
 			select {
-			case <-ticker.C:
-				output, err := o.DoSync()
+			case t := <-ticker.C:
+				record, err := o.DoSync()
 				l := logrus.WithField("sync", "git")
 				if err != nil {
 					l = l.WithError(err)
 				}
-				l.Info(output)
+				l.Info(record.String())
+				o.Health.LoopTick()
+				o.Web.History.SetNextSync(t.Add(o.SyncDuration))
 
 			case <-quit:
 				ticker.Stop()
@@ -117,11 +254,44 @@ func (o *Options) Run() error {
 	ctx := context.Background()
 	kubeClient := o.KubeClient
 
+	o.Disk.Start(ctx)
+
 	o.Masker, err = masker.NewMasker(kubeClient, namespace, o.OperatorNamespace)
 	if err != nil {
 		return errors.Wrapf(err, "failed to create masker")
 	}
 
+	if !o.NoEvents {
+		o.events = &EventCollector{
+			LogDir:      filepath.Join(o.Dir, o.LogPath),
+			ResourceDir: filepath.Join(o.Dir, o.ResourcePath),
+			Layout:      o.layout(),
+			KubeClient:  kubeClient,
+			Masker:      o.Masker,
+		}
+		err = o.events.Start(ctx, namespace)
+		if err != nil {
+			return errors.Wrap(err, "failed to collect events")
+		}
+	}
+
+	if !o.NoCombinedLogs {
+		o.combined = &CombinedLogs{}
+	}
+	o.tests = &TestCollector{
+		LogDir: filepath.Join(o.Dir, o.LogPath),
+	}
+	if !o.NoCompletionSync {
+		o.completions = &completions{
+			debouncer: &Debouncer{
+				Delay:    o.CompletionSyncDelay,
+				MaxDelay: o.CompletionSyncMaxDelay,
+				Fn:       o.syncOnCompletion,
+			},
+		}
+		o.watchActivities(ctx, o.Resources.DynamicClient, namespace)
+	}
+
 	added, removed, err := o.Watch(ctx, kubeClient.CoreV1().Pods(namespace), o.LabelSelector)
 	if err != nil {
 		return errors.Wrap(err, "failed to set up watch")
@@ -131,24 +301,105 @@ func (o *Options) Run() error {
 
 	podLogDir := filepath.Join(o.Dir, o.LogPath)
 
-	go func() {
-		for p := range added {
-			id := p.GetID()
-			if tails[id] != nil {
-				continue
+	compressMinBytes := int64(0)
+	if o.CompressLogs {
+		compressMinBytes = o.CompressMinBytes
+		if compressMinBytes <= 0 {
+			compressMinBytes = 1
+		}
+	}
+	limits := NewLogLimits(o.MaxLogBytes, o.LogHeadBytes, o.LogTailBytes, o.totalLogs)
+	if o.combined != nil {
+		o.combined.Limits = limits
+	}
+
+	startTail := func(p *Target) {
+		id := p.GetID()
+		if tails[id] != nil {
+			if p.Terminated {
+				tails[id].ContainerTerminated()
+			}
+			return
+		}
+
+		podDir := filepath.Join(podLogDir, p.Path)
+		tail := NewTail(o.Masker, podDir, p.Namespace, p.Pod, p.Container, o.Template, &TailOptions{
+			Timestamps:   o.Timestamps,
+			SinceSeconds: int64(o.Since.Seconds()),
+			Exclude:      o.Exclude,
+			Include:      o.Include,
+			Namespace:    o.AllNamespaces,
+			TailLines:    o.TailLines,
+
+			CompressMinBytes: compressMinBytes,
+			Limits:           limits,
+			Sanitize:         o.SanitizeLogs,
+			Multiline:        o.multiline,
+		})
+		tail.OnTruncated = func(dropped int64) {
+			err := o.saveTruncation(p, dropped)
+			if err != nil {
+				logrus.WithError(err).Errorf("failed to save truncation of %s", id)
+			}
+		}
+		tail.Handlers = append(tail.Handlers, o.tests.LineHandler(p))
+		tail.Outputs = append(tail.Outputs, o.streams.Output(p, filepath.Join(podDir, p.Container+logfiles.LogExtension), tail.Format))
+		if o.search != nil {
+			tail.Outputs = append(tail.Outputs, o.newIndexOutput(p, limits))
+		}
+		if o.NDJSON {
+			output, err := NewNDJSONOutput(filepath.Join(podDir, p.Container+NDJSONExtension), limits)
+			if err != nil {
+				logrus.WithError(err).Errorf("failed to create NDJSON output for %s", id)
+			} else {
+				tail.Outputs = append(tail.Outputs, output)
 			}
+		}
+		if o.combined != nil {
+			tail.Outputs = append(tail.Outputs, o.combined.Output(filepath.Join(podDir, CombinedLogFileName), p.Container))
+			if p.RunPath != p.Path {
+				prefix := p.Task
+				if prefix == "" {
+					prefix = p.Pod
+				}
+				prefix += "/" + p.Container
+				tail.Outputs = append(tail.Outputs, o.combined.Output(filepath.Join(podLogDir, p.RunPath, CombinedLogFileName), prefix))
+			}
+		}
+		tails[id] = tail
 
-			tail := NewTail(o.Masker, podLogDir, p.Namespace, p.Pod, p.Container, p.App, o.Template, &TailOptions{
-				Timestamps:   o.Timestamps,
-				SinceSeconds: int64(o.Since.Seconds()),
-				Exclude:      o.Exclude,
-				Include:      o.Include,
-				Namespace:    o.AllNamespaces,
-				TailLines:    o.TailLines,
-			})
-			tails[id] = tail
+		o.activePods.Add(p, filepath.Join(o.LogPath, p.Path))
 
-			tail.Start(ctx, kubeClient.CoreV1().Pods(p.Namespace))
+		if p.Terminated {
+			tail.ContainerTerminated()
+		}
+		tail.Start(ctx, kubeClient.CoreV1().Pods(p.Namespace))
+	}
+
+	go func() {
+		// lets queue new containers while the disk usage is too high
+		var pending []*Target
+		for {
+			var resumed <-chan struct{}
+			if len(pending) > 0 {
+				resumed = o.Disk.Resumed()
+			}
+			select {
+			case p, ok := <-added:
+				if !ok {
+					return
+				}
+				if o.Disk.Paused() {
+					pending = append(pending, p)
+					continue
+				}
+				startTail(p)
+			case <-resumed:
+				for _, p := range pending {
+					startTail(p)
+				}
+				pending = nil
+			}
 		}
 	}()
 
@@ -158,8 +409,11 @@ func (o *Options) Run() error {
 			if tails[id] == nil {
 				continue
 			}
+			// the containers of a deleted pod cannot write any more output
+			tails[id].ContainerTerminated()
 			tails[id].Close()
 			delete(tails, id)
+			o.activePods.Remove(p)
 		}
 	}()
 
@@ -170,18 +424,45 @@ func (o *Options) Run() error {
 
 // ValidateOptions validates the options and lazily creates any resources required
 func (o *Options) ValidateOptions() error {
-	o.Web.Sync = func() (string, error) {
-		return o.DoSync()
-	}
+	o.Web.Sync = o.webSync
 
 	var err error
 	o.KubeClient, err = kube.LazyCreateKubeClient(o.KubeClient)
 	if err != nil {
 		return errors.Wrapf(err, "failed to create kube client")
 	}
+	if o.Web.Authorizer == nil {
+		o.Web.Authorizer, err = o.Web.Auth.NewAuthorizer(o.KubeClient)
+		if err != nil {
+			return errors.Wrapf(err, "failed to set up web authentication")
+		}
+	}
 	if o.LabelSelector == nil {
 		o.LabelSelector = labels.NewSelector()
 	}
+	if o.Template == nil && o.LineTemplate != "" {
+		o.Template, err = template.New("line").Parse(o.LineTemplate)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse line template %s", o.LineTemplate)
+		}
+		err = o.Template.Execute(ioutil.Discard, &Line{Timestamp: time.Now(), Message: "sample"})
+		if err != nil {
+			return errors.Wrapf(err, "invalid line template %s", o.LineTemplate)
+		}
+	}
+	if o.Multiline {
+		o.multiline, err = NewMultilineOptions(o.MultilineContinuation)
+		if err != nil {
+			return errors.Wrapf(err, "invalid multiline options")
+		}
+		if o.MultilineFlushDelay > 0 {
+			o.multiline.FlushDelay = o.MultilineFlushDelay
+		}
+	}
+	o.podLayout, err = NewLayout(o.Layout, o.PodPathTemplate, o.RunPathTemplate)
+	if err != nil {
+		return errors.Wrapf(err, "invalid layout")
+	}
 	if o.SyncDuration.Milliseconds() == int64(0) {
 		o.SyncDuration = time.Minute * 5
 	}
@@ -202,19 +483,158 @@ func (o *Options) ValidateOptions() error {
 	if err != nil {
 		return errors.Wrapf(err, "failed to setup resource fetcher")
 	}
+
+	if o.Layout == LayoutPipelineRun {
+		o.Resources.OnResource = o.saveRunResource
+	}
+
+	o.Disk.Dir = o.Dir
+	o.Disk.OnHigh = o.freeDiskSpace
+	o.Health.SyncDuration = o.SyncDuration
+	o.Web.Ready = o.isReady
+	o.Web.Live = o.Health.Live
+	o.streams.Retention = o.StreamRetention
+	o.Web.Logs = &o.streams
+	o.Web.Targets = &o.streams
+	if o.SearchMaxLines > 0 && o.search == nil {
+		o.search = &search.Index{MaxLines: o.SearchMaxLines}
+		o.Web.Search = o.search
+	}
+	o.Web.ResourceFile = func(group, version, resource, namespace, name string) (string, error) {
+		return o.Resources.FileName(schema.GroupVersionResource{Group: group, Version: version, Resource: resource}, namespace, name)
+	}
+	o.Web.Dir = o.Dir
+	o.Web.LogPath = o.LogPath
+	o.Web.ResourcePath = o.ResourcePath
+
+	o.Flaky.Dir = filepath.Join(o.Dir, o.LogPath)
+	o.Flaky.OutDir = filepath.Join(o.Dir, o.ReportPath)
+
+	if o.MaxTotalLogBytes > 0 && o.totalLogs == nil {
+		o.totalLogs = &TotalLogBytes{MaxBytes: o.MaxTotalLogBytes}
+	}
 	return nil
 }
 
 // DoSync dumps all of the kubernetes resources and syncs the resources
-// and logs to the git store
-func (o *Options) DoSync() (string, error) {
+// and logs to the git store recording the result in the sync history.
+//
+// If a sync is already in progress it may have started before the changes which triggered the call so a
+// pending sync is run once it completes and its result is returned. All the callers which arrive while a
+// sync is in progress share the same pending sync
+func (o *Options) DoSync() (*web.SyncRecord, error) {
+	o.syncLock.Lock()
+	c := o.syncing
+	if c != nil {
+		if o.syncPending == nil {
+			o.syncPending = &syncCall{done: make(chan struct{})}
+		}
+		c = o.syncPending
+		o.syncLock.Unlock()
+		<-c.done
+		return c.record, c.err
+	}
+	c = &syncCall{done: make(chan struct{})}
+	o.syncing = c
+	o.syncLock.Unlock()
+
+	o.runSyncCall(c)
+	return c.record, c.err
+}
+
+// runSyncCall performs the sync and then starts the pending sync in the background if any callers
+// arrived while it was in progress
+func (o *Options) runSyncCall(c *syncCall) {
+	c.record, c.err = o.runSync()
+
+	o.syncLock.Lock()
+	next := o.syncPending
+	o.syncPending = nil
+	o.syncing = next
+	o.syncLock.Unlock()
+	close(c.done)
+
+	if next != nil {
+		logrus.WithField("sync", "git").Info("running a pending sync triggered while the last sync was in progress")
+		go o.runSyncCall(next)
+	}
+}
+
+// webSync performs a sync requested via the web server once the git store has been set up
+func (o *Options) webSync() (*web.SyncRecord, error) {
+	if !o.Health.IsSetup() {
+		return nil, errors.Errorf("the git store is not set up yet")
+	}
+	return o.DoSync()
+}
+
+// runSync performs a sync recording its duration and result
+func (o *Options) runSync() (*web.SyncRecord, error) {
+	started := time.Now()
+	result, err := o.doSync()
+	o.totalLogs.Update()
+	metrics.SyncResult(time.Since(started).Seconds(), err)
+	o.Health.SyncResult(err)
+	return o.Web.History.Add(started, result, err), err
+}
+
+func (o *Options) doSync() (*gitstore.SyncResult, error) {
 	err := o.Resources.Run()
 	if err != nil {
-		return "", errors.Wrapf(err, "failed to get kubernetes resources")
+		return nil, errors.Wrapf(err, "failed to get kubernetes resources")
+	}
+	err = o.Flaky.Run()
+	if err != nil {
+		// lets still sync the logs if the report cannot be generated
+		logrus.WithError(err).Warn("failed to generate flaky tests report")
 	}
 	return o.GitStore.Sync()
 }
 
+// isReady returns an error if the collector is not set up, not watching pods or the disk is too full
+func (o *Options) isReady() error {
+	err := o.Health.Ready()
+	if err != nil {
+		return err
+	}
+	return o.Disk.Ready()
+}
+
+// freeDiskSpace syncs the local files to the git store and then evicts the synchronised files
+// which are not being written or needed to generate reports
+func (o *Options) freeDiskSpace() error {
+	record, err := o.DoSync()
+	if err != nil {
+		return errors.Wrapf(err, "failed to sync before evicting files")
+	}
+	logrus.WithField("sync", "git").Info(record.String())
+
+	reportPath := filepath.ToSlash(o.ReportPath) + "/"
+	_, err = o.GitStore.Evict(o.Disk.EvictMinAge, func(path string) bool {
+		switch filepath.Base(path) {
+		case testresults.FileName, JUnitSummaryFileName, MetadataFileName, CombinedLogFileName:
+			return true
+		}
+		if strings.HasPrefix(path, reportPath) {
+			return true
+		}
+		return o.activePods.Active(path)
+	})
+	if err != nil {
+		return errors.Wrapf(err, "failed to evict synchronised files")
+	}
+	o.totalLogs.Update()
+	return nil
+}
+
+// layout returns the layout of the log directory
+func (o *Options) layout() Layout {
+	if o.podLayout == nil {
+		o.podLayout = DefaultLayout()
+	}
+	return o.podLayout
+}
+
 // MatchPod for filtering on the pod
 func (o *Options) MatchPod(_ *corev1.Pod) bool {
 	return true
@@ -0,0 +1,78 @@
+package tailer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ansiEscapes matches ANSI CSI sequences such as colours, OSC sequences such as titles and hyperlinks
+// and the remaining two character escape sequences
+var ansiEscapes = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// SanitizeLine removes ANSI escape sequences from the line and collapses carriage return, backspace and
+// erase in line rewrites, such as progress bars, into the text a terminal would finally display
+func SanitizeLine(text string) string {
+	if !strings.ContainsAny(text, "\x1b\r\b") {
+		return text
+	}
+
+	l := &terminalLine{}
+	last := 0
+	for _, m := range ansiEscapes.FindAllStringIndex(text, -1) {
+		l.write(text[last:m[0]])
+		l.escape(text[m[0]:m[1]])
+		last = m[1]
+	}
+	l.write(text[last:])
+	return string(l.buf)
+}
+
+// terminalLine the text displayed on a terminal line and the position of the cursor
+type terminalLine struct {
+	buf    []rune
+	cursor int
+}
+
+// write writes the text at the cursor handling carriage returns and backspaces
+func (l *terminalLine) write(text string) {
+	for _, r := range text {
+		switch r {
+		case '\r':
+			l.cursor = 0
+		case '\b':
+			if l.cursor > 0 {
+				l.cursor--
+			}
+		default:
+			if l.cursor < len(l.buf) {
+				l.buf[l.cursor] = r
+			} else {
+				l.buf = append(l.buf, r)
+			}
+			l.cursor++
+		}
+	}
+}
+
+// escape applies the erase in line sequences; all other escape sequences are ignored
+func (l *terminalLine) escape(seq string) {
+	if !strings.HasPrefix(seq, "\x1b[") || !strings.HasSuffix(seq, "K") {
+		return
+	}
+	switch seq[2 : len(seq)-1] {
+	case "", "0":
+		// erase from the cursor to the end of the line
+		l.buf = l.buf[:l.cursor]
+	case "1":
+		// erase from the start of the line to the cursor
+		for i := 0; i <= l.cursor && i < len(l.buf); i++ {
+			l.buf[i] = ' '
+		}
+	case "2":
+		// erase the whole line
+		l.buf = l.buf[:l.cursor]
+		for i := range l.buf {
+			l.buf[i] = ' '
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package tailer
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/web"
+)
+
+const (
+	// streamBufferLines the number of lines buffered for each subscriber before it is disconnected
+	streamBufferLines = 1000
+
+	// DefaultStreamRetention the default time the stream of a finished container is kept if its pod is not deleted
+	DefaultStreamRetention = time.Hour
+)
+
+// LogStreams tracks the log files of the containers being tailed so that they can be listed, served and followed
+// via the web server.
+//
+// The streams of a pod are removed when the pod is deleted and finished streams are removed after the Retention
+type LogStreams struct {
+	// Retention how long the stream of a finished container is kept. Defaults to DefaultStreamRetention
+	Retention time.Duration
+
+	// Now returns the current time. Defaults to time.Now
+	Now func() time.Time
+
+	lock    sync.Mutex
+	streams map[string]*logStream
+	nextID  int
+}
+
+type logStream struct {
+	target      Target
+	fileName    string
+	started     time.Time
+	lines       int
+	bytes       int64
+	done        bool
+	finished    time.Time
+	subscribers map[int]chan string
+}
+
+// streamOutput publishes the formatted lines of a container to its subscribers
+type streamOutput struct {
+	streams *LogStreams
+	stream  *logStream
+	format  func(*Line) string
+}
+
+// Output returns the output which publishes the lines of the target container, formatted with the given
+// function, which are written to the given log file
+func (s *LogStreams) Output(target *Target, fileName string, format func(*Line) string) Output {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.streams == nil {
+		s.streams = map[string]*logStream{}
+	}
+	s.prune()
+	key := streamKey(target.Namespace, target.Pod, target.Container)
+	stream := s.streams[key]
+	if stream != nil {
+		stream.closeSubscribers()
+	}
+	stream = &logStream{
+		target:      *target,
+		fileName:    fileName,
+		started:     s.now(),
+		subscribers: map[int]chan string{},
+	}
+	s.streams[key] = stream
+	return &streamOutput{
+		streams: s,
+		stream:  stream,
+		format:  format,
+	}
+}
+
+// LogFile returns the file name of the log of the container
+func (s *LogStreams) LogFile(namespace, pod, container string) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stream := s.streams[streamKey(namespace, pod, container)]
+	if stream == nil {
+		return "", os.ErrNotExist
+	}
+	return stream.fileName, nil
+}
+
+// Targets returns the status of the container logs
+func (s *LogStreams) Targets() []*web.TargetStatus {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.prune()
+	answer := make([]*web.TargetStatus, 0, len(s.streams))
+	for _, stream := range s.streams {
+		t := &stream.target
+		answer = append(answer, &web.TargetStatus{
+			Namespace:   t.Namespace,
+			Pod:         t.Pod,
+			Container:   t.Container,
+			App:         t.App,
+			Path:        t.Path,
+			RunPath:     t.RunPath,
+			PipelineRun: t.PipelineRun,
+			Task:        t.Task,
+			Tailing:     !stream.done,
+			Lines:       stream.lines,
+			Bytes:       stream.bytes,
+			LogFile:     stream.fileName,
+			Started:     stream.started,
+		})
+	}
+	sort.Slice(answer, func(i, j int) bool {
+		return streamKey(answer[i].Namespace, answer[i].Pod, answer[i].Container) < streamKey(answer[j].Namespace, answer[j].Pod, answer[j].Container)
+	})
+	return answer
+}
+
+// Follow subscribes to the lines of the container log if it is still being written
+func (s *LogStreams) Follow(namespace, pod, container string) *web.Subscription {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	stream := s.streams[streamKey(namespace, pod, container)]
+	if stream == nil || stream.done {
+		return nil
+	}
+	s.nextID++
+	id := s.nextID
+	ch := make(chan string, streamBufferLines)
+	stream.subscribers[id] = ch
+	return &web.Subscription{
+		Lines:  ch,
+		Offset: stream.lines,
+		Cancel: func() {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+
+			if stream.subscribers[id] != nil {
+				delete(stream.subscribers, id)
+				close(ch)
+			}
+		},
+	}
+}
+
+// Write publishes the line to the subscribers, disconnecting any which cannot keep up
+func (o *streamOutput) Write(line *Line) {
+	text := o.format(line)
+
+	s := o.streams
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	o.stream.lines += strings.Count(text, "\n") + 1
+	o.stream.bytes += int64(len(text)) + 1
+	for id, ch := range o.stream.subscribers {
+		select {
+		case ch <- text:
+		default:
+			delete(o.stream.subscribers, id)
+			close(ch)
+		}
+	}
+}
+
+// Close completes the stream of the container
+func (o *streamOutput) Close() {
+	s := o.streams
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	o.stream.done = true
+	o.stream.finished = s.now()
+	o.stream.closeSubscribers()
+}
+
+// OnPodDeleted removes the streams of the containers of a deleted pod. The log files are kept
+func (s *LogStreams) OnPodDeleted(namespace, pod string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for key, stream := range s.streams {
+		if stream.target.Namespace == namespace && stream.target.Pod == pod {
+			stream.closeSubscribers()
+			delete(s.streams, key)
+		}
+	}
+}
+
+// prune removes the streams which finished before the retention period
+func (s *LogStreams) prune() {
+	retention := s.Retention
+	if retention <= 0 {
+		retention = DefaultStreamRetention
+	}
+	before := s.now().Add(-retention)
+	for key, stream := range s.streams {
+		if stream.done && stream.finished.Before(before) {
+			delete(s.streams, key)
+		}
+	}
+}
+
+func (s *LogStreams) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+func (l *logStream) closeSubscribers() {
+	for id, ch := range l.subscribers {
+		delete(l.subscribers, id)
+		close(ch)
+	}
+}
+
+func streamKey(namespace, pod, container string) string {
+	return strings.Join([]string{namespace, pod, container}, "/")
+}
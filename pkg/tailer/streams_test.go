@@ -0,0 +1,122 @@
+package tailer_test
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
+	"github.com/jenkins-x/jx-test-collector/pkg/tailer"
+	"github.com/jenkins-x/jx-test-collector/pkg/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogStreams(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	fileName := filepath.Join(tmpDir, "step-test.log")
+	err = ioutil.WriteFile(fileName, []byte("line 1\nline 2\n"), files.DefaultFileWritePermissions)
+	require.NoError(t, err, "failed to save file %s", fileName)
+
+	streams := &tailer.LogStreams{}
+	target := &tailer.Target{Namespace: "jx", Pod: "mypod", Container: "step-test"}
+	format := func(l *tailer.Line) string {
+		return l.Message
+	}
+	output := streams.Output(target, fileName, format)
+	output.Write(&tailer.Line{Message: "line 1"})
+	output.Write(&tailer.Line{Message: "line 2"})
+
+	o := &web.Options{Logs: streams}
+	server := httptest.NewServer(o.Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/logs/jx/mypod/unknown")
+	require.NoError(t, err, "failed to get unknown log")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode, "status of unknown log")
+
+	resp, err = http.Get(server.URL + "/logs/jx/mypod/step-test")
+	require.NoError(t, err, "failed to get log")
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err, "failed to read log")
+	assert.Equal(t, "line 1\nline 2\n", string(data), "log")
+
+	resp, err = http.Get(server.URL + "/logs/jx/mypod/step-test?follow=true")
+	require.NoError(t, err, "failed to follow log")
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	for _, expected := range []string{"line 1\n", "line 2\n"} {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err, "failed to read line")
+		assert.Equal(t, expected, line, "stored line")
+	}
+
+	// lets simulate the tailer writing a line to the file which is published
+	// after the subscription was made
+	err = ioutil.WriteFile(fileName, []byte("line 1\nline 2\nline 3\n"), files.DefaultFileWritePermissions)
+	require.NoError(t, err, "failed to save file %s", fileName)
+	output.Write(&tailer.Line{Message: "line 3"})
+	output.Close()
+
+	rest, err := ioutil.ReadAll(reader)
+	require.NoError(t, err, "failed to read streamed lines")
+	assert.Equal(t, "line 3\n", string(rest), "streamed lines")
+}
+
+func TestLogStreamsPruned(t *testing.T) {
+	now := time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)
+	streams := &tailer.LogStreams{
+		Retention: time.Hour,
+		Now: func() time.Time {
+			return now
+		},
+	}
+	format := func(l *tailer.Line) string {
+		return l.Message
+	}
+	podNames := func() []string {
+		var answer []string
+		for _, t := range streams.Targets() {
+			answer = append(answer, t.Pod+"/"+t.Container)
+		}
+		return answer
+	}
+
+	build := streams.Output(&tailer.Target{Namespace: "jx", Pod: "pod1", Container: "step-build"}, "pod1/step-build.log", format)
+	test := streams.Output(&tailer.Target{Namespace: "jx", Pod: "pod1", Container: "step-test"}, "pod1/step-test.log", format)
+	streams.Output(&tailer.Target{Namespace: "jx", Pod: "pod2", Container: "step-build"}, "pod2/step-build.log", format)
+	finished := streams.Output(&tailer.Target{Namespace: "jx", Pod: "pod3", Container: "step-build"}, "pod3/step-build.log", format)
+	assert.Equal(t, []string{"pod1/step-build", "pod1/step-test", "pod2/step-build", "pod3/step-build"}, podNames(), "targets")
+
+	sub := streams.Follow("jx", "pod1", "step-test")
+	require.NotNil(t, sub, "should follow a running container")
+
+	// the streams of a deleted pod are removed and their subscribers disconnected
+	build.Close()
+	streams.OnPodDeleted("jx", "pod1")
+	assert.Equal(t, []string{"pod2/step-build", "pod3/step-build"}, podNames(), "targets after the pod is deleted")
+	_, ok := <-sub.Lines
+	assert.False(t, ok, "the subscription should be closed")
+	_, err := streams.LogFile("jx", "pod1", "step-build")
+	assert.Error(t, err, "the log of a deleted pod should not be found")
+
+	// writing to the stream of a deleted pod is ignored
+	test.Write(&tailer.Line{Message: "line 1"})
+	test.Close()
+
+	// finished streams are removed after the retention
+	finished.Close()
+	now = now.Add(30 * time.Minute)
+	assert.Equal(t, []string{"pod2/step-build", "pod3/step-build"}, podNames(), "targets within the retention")
+
+	now = now.Add(time.Hour)
+	assert.Equal(t, []string{"pod2/step-build"}, podNames(), "targets after the retention")
+}
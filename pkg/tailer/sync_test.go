@@ -0,0 +1,176 @@
+package tailer_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
+	"github.com/jenkins-x/jx-test-collector/pkg/resources"
+	"github.com/jenkins-x/jx-test-collector/pkg/tailer"
+	"github.com/jenkins-x/jx-test-collector/pkg/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+// fakeGit a git client which records how many git commands run at the same time
+type fakeGit struct {
+	lock     sync.Mutex
+	running  int
+	overlaps int
+	pushes   int
+}
+
+func (g *fakeGit) Command(dir string, args ...string) (string, error) {
+	g.lock.Lock()
+	g.running++
+	if g.running > 1 {
+		g.overlaps++
+	}
+	if args[0] == "push" {
+		g.pushes++
+	}
+	g.lock.Unlock()
+
+	defer func() {
+		g.lock.Lock()
+		g.running--
+		g.lock.Unlock()
+	}()
+
+	switch args[0] {
+	case "status":
+		return "M logs/mypod/step-build.log", nil
+	case "rev-parse":
+		return "0123456789abcdef0123456789abcdef01234567", nil
+	case "diff-tree":
+		return "M\x00logs/mypod/step-build.log\x00", nil
+	case "push":
+		// lets make the push slow so that syncs would overlap
+		time.Sleep(200 * time.Millisecond)
+	}
+	return "", nil
+}
+
+func TestConcurrentSyncs(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+	defer os.RemoveAll(tmpDir)
+
+	g := &fakeGit{}
+	o := newSyncOptions(t, tmpDir, g)
+
+	const callers = 10
+	records := make([]*web.SyncRecord, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			record, err := o.DoSync()
+			assert.NoError(t, err, "failed to sync")
+			records[i] = record
+		}(i)
+	}
+	wg.Wait()
+
+	// the first caller starts a sync and the callers which arrive during it share one pending sync
+	assert.Equal(t, 0, g.overlaps, "overlapping git commands")
+	assert.Equal(t, 2, g.pushes, "git pushes")
+	history := o.Web.History.Records()
+	require.Len(t, history, 2, "sync history")
+	counts := map[*web.SyncRecord]int{}
+	for _, r := range records {
+		counts[r]++
+	}
+	assert.Equal(t, 1, counts[history[1]], "callers of the first sync")
+	assert.Equal(t, callers-1, counts[history[0]], "callers of the pending sync")
+	assert.Equal(t, 1, history[0].FilesChanged, "files changed")
+
+	// lets check that later syncs and evictions run one at a time
+	for i := 0; i < callers; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := o.DoSync()
+			assert.NoError(t, err, "failed to sync")
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := o.GitStore.Evict(0, nil)
+			assert.NoError(t, err, "failed to evict")
+		}()
+		time.Sleep(20 * time.Millisecond)
+	}
+	wg.Wait()
+
+	assert.Equal(t, 0, g.overlaps, "overlapping git commands")
+	assert.True(t, g.pushes > 1, "should sync again once the first sync completes")
+}
+
+func TestPendingSync(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+	defer os.RemoveAll(tmpDir)
+
+	g := &fakeGit{}
+	o := newSyncOptions(t, tmpDir, g)
+
+	var first *web.SyncRecord
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var err error
+		first, err = o.DoSync()
+		assert.NoError(t, err, "failed to sync")
+	}()
+
+	// lets trigger a sync while the first sync is pushing
+	require.Eventually(t, func() bool {
+		g.lock.Lock()
+		defer g.lock.Unlock()
+		return g.pushes == 1
+	}, 5*time.Second, time.Millisecond, "the first sync should push")
+	pending, err := o.DoSync()
+	require.NoError(t, err, "failed to sync")
+	wg.Wait()
+
+	assert.NotSame(t, first, pending, "the caller should get the result of the pending sync")
+	assert.Equal(t, 0, g.overlaps, "overlapping git commands")
+	assert.Equal(t, 2, g.pushes, "git pushes")
+	records := o.Web.History.Records()
+	require.Len(t, records, 2, "sync history")
+	assert.Same(t, first, records[1], "oldest sync")
+	assert.Same(t, pending, records[0], "newest sync")
+	assert.False(t, pending.Started.Before(first.Started.Add(first.Duration)), "the pending sync should start after the first sync")
+
+	// a sync which does not overlap does not run a pending sync
+	_, err = o.DoSync()
+	require.NoError(t, err, "failed to sync")
+	assert.Equal(t, 3, g.pushes, "git pushes")
+	assert.Len(t, o.Web.History.Records(), 3, "sync history")
+}
+
+func newSyncOptions(t *testing.T, tmpDir string, g *fakeGit) *tailer.Options {
+	logDir := filepath.Join(tmpDir, "logs")
+	err := os.MkdirAll(logDir, files.DefaultDirWritePermissions)
+	require.NoError(t, err, "failed to create dir %s", logDir)
+
+	o := &tailer.Options{}
+	o.GitStore.Dir = tmpDir
+	o.GitStore.GitClient = g
+	o.GitStore.Branch = "gh-pages"
+	o.Resources.Dir = filepath.Join(tmpDir, "resources")
+	o.Resources.Ctx = context.TODO()
+	o.Resources.DynamicClient = fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), resources.ResourceMap)
+	o.Flaky.Dir = logDir
+	o.Flaky.OutDir = filepath.Join(tmpDir, "reports")
+	return o
+}
@@ -21,14 +21,20 @@ import (
 	"bufio"
 	"context"
 	"hash/fnv"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
+	"sync"
 	"text/template"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/jenkins-x-plugins/jx-secret/pkg/masker"
 	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
+	"github.com/jenkins-x/jx-test-collector/pkg/logfiles"
+	"github.com/jenkins-x/jx-test-collector/pkg/metrics"
 	"github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes/typed/core/v1"
@@ -41,6 +47,9 @@ type Tail struct {
 	PodName        string
 	ContainerName  string
 	Options        *TailOptions
+	Handlers       []LineHandler
+	Outputs        []Output
+	OnTruncated    func(dropped int64)
 	req            *rest.Request
 	closed         chan struct{}
 	podColor       *color.Color
@@ -48,6 +57,39 @@ type Tail struct {
 	tmpl           *template.Template
 	log            *logrus.Entry
 	masker         *masker.Client
+	done           chan struct{}
+
+	lock       sync.Mutex
+	terminated bool
+	finished   bool
+	compressed bool
+}
+
+// Line a line of a container log which is used as the data for line templates
+type Line struct {
+	Timestamp time.Time
+	Namespace string
+	Pod       string
+	Container string
+	Message   string
+}
+
+// LineHandler processes the masked lines of a container log before they are filtered
+type LineHandler interface {
+	// Line processes the next line
+	Line(line string)
+
+	// Close is invoked when the log has been completely read
+	Close()
+}
+
+// Output receives the masked lines of a container log which pass the filters
+type Output interface {
+	// Write writes the line
+	Write(line *Line)
+
+	// Close is invoked when the log has been completely read
+	Close()
 }
 
 type TailOptions struct {
@@ -57,10 +99,24 @@ type TailOptions struct {
 	Include      []*regexp.Regexp
 	Namespace    bool
 	TailLines    *int64
+
+	// CompressMinBytes if positive the log file is gzipped once the container terminates
+	// if it is at least this size
+	CompressMinBytes int64
+
+	// Limits the optional limits on the size of the log file
+	Limits *LogLimits
+
+	// Multiline if specified groups lines into records such as stack traces which are filtered as a whole
+	Multiline *MultilineOptions
+
+	// Sanitize removes ANSI escape sequences and collapses carriage return rewrites before lines are
+	// masked and filtered
+	Sanitize bool
 }
 
-// NewTail returns a new tail for a Kubernetes container inside a pod
-func NewTail(masker *masker.Client, dir, namespace, podName, containerName, app string, tmpl *template.Template, options *TailOptions) *Tail {
+// NewTail returns a new tail for a Kubernetes container inside a pod writing to the given pod directory
+func NewTail(masker *masker.Client, podDir, namespace, podName, containerName string, tmpl *template.Template, options *TailOptions) *Tail {
 	log := logrus.WithFields(
 		map[string]interface{}{
 			"Namespace": namespace,
@@ -68,11 +124,6 @@ func NewTail(masker *masker.Client, dir, namespace, podName, containerName, app
 			"Container": containerName,
 		})
 
-	nsDir := filepath.Join(dir, namespace)
-	if app != "" {
-		nsDir = filepath.Join(nsDir, app)
-	}
-	podDir := filepath.Join(nsDir, podName)
 	err := os.MkdirAll(podDir, files.DefaultDirWritePermissions)
 	if err != nil {
 		log.WithError(err).Errorf("failed to create dir: %s", podDir)
@@ -87,6 +138,7 @@ func NewTail(masker *masker.Client, dir, namespace, podName, containerName, app
 		Options:       options,
 		masker:        masker,
 		closed:        make(chan struct{}),
+		done:          make(chan struct{}),
 		tmpl:          tmpl,
 	}
 }
@@ -114,15 +166,30 @@ func (t *Tail) Start(ctx context.Context, i v1.PodInterface) {
 	t.podColor, t.containerColor = determineColor(t.PodName)
 
 	go func() {
+		metrics.ActiveTails.Inc()
+		defer func() {
+			metrics.ActiveTails.Dec()
+			for _, h := range t.Handlers {
+				h.Close()
+			}
+			for _, o := range t.Outputs {
+				o.Close()
+			}
+			t.finish()
+			close(t.done)
+		}()
+
+		fileName := t.fileName()
+
 		req := i.GetLogs(t.PodName, &corev1.PodLogOptions{
-			Follow:     true,
-			Timestamps: t.Options.Timestamps,
+			Follow: true,
+			// lets always get the timestamps so they can be used by line templates
+			Timestamps: true,
 			Container:  t.ContainerName,
 			TailLines:  t.Options.TailLines,
 			//SinceSeconds: &t.Options.SinceSeconds,
 		})
 
-		fileName := filepath.Join(t.Dir, t.ContainerName+".log")
 		file, err := os.Create(fileName)
 		if err != nil {
 			t.log.WithError(err).Errorf("failed to create output")
@@ -130,7 +197,24 @@ func (t *Tail) Start(ctx context.Context, i v1.PodInterface) {
 		}
 		defer file.Close()
 
-		writer := bufio.NewWriter(file)
+		// lets remove any compressed log from a previous collector
+		os.Remove(fileName + logfiles.GzipExtension)
+
+		limited := NewLimitedWriter(file, t.Options.Limits)
+		defer func() {
+			dropped, err := limited.Close()
+			if err != nil {
+				t.log.WithError(err).Warn("failed to write the tail of the truncated log")
+			}
+			if dropped > 0 {
+				t.log.Infof("truncated %d bytes of the log", dropped)
+				if t.OnTruncated != nil {
+					t.OnTruncated(dropped)
+				}
+			}
+		}()
+
+		writer := bufio.NewWriter(limited)
 		defer writer.Flush()
 
 		ctx := context.Background()
@@ -142,60 +226,249 @@ func (t *Tail) Start(ctx context.Context, i v1.PodInterface) {
 		defer stream.Close()
 
 		go func() {
+			// closing the stream ends the read loop which then flushes and closes the file
 			<-t.closed
 			stream.Close()
-			writer.Flush()
-			file.Close()
 		}()
 
-		reader := bufio.NewReader(stream)
+		t.ReadLines(stream, writer)
+	}()
+
+	go func() {
+		<-ctx.Done()
+		close(t.closed)
+	}()
+}
+
+// Close stops tailing
+func (t *Tail) Close() {
+	close(t.closed)
+}
+
+// Done returns a channel which is closed once the log has been read and the file closed
+func (t *Tail) Done() <-chan struct{} {
+	return t.done
+}
+
+// ContainerTerminated records that the pod status shows the container has terminated so that the log file
+// is compressed once it has been completely read. The end of the log stream is not enough as the stream
+// may fail or be disconnected while the container is still running
+func (t *Tail) ContainerTerminated() {
+	t.lock.Lock()
+	t.terminated = true
+	compress := t.finished
+	t.lock.Unlock()
+
+	if compress {
+		t.compress()
+	}
+}
+
+// finish records that the log file has been closed compressing it if the container has terminated
+func (t *Tail) finish() {
+	t.lock.Lock()
+	t.finished = true
+	compress := t.terminated
+	t.lock.Unlock()
+
+	if compress {
+		t.compress()
+	}
+}
+
+// compress gzips the log file once if compression is enabled
+func (t *Tail) compress() {
+	if t.Options.CompressMinBytes <= 0 {
+		return
+	}
+	t.lock.Lock()
+	if t.compressed {
+		t.lock.Unlock()
+		return
+	}
+	t.compressed = true
+	t.lock.Unlock()
+
+	_, err := logfiles.Compress(t.fileName(), t.Options.CompressMinBytes)
+	if err != nil {
+		t.log.WithError(err).Warn("failed to compress log")
+	}
+}
+
+// fileName returns the name of the log file
+func (t *Tail) fileName() string {
+	return filepath.Join(t.Dir, t.ContainerName+logfiles.LogExtension)
+}
 
-	OUTER:
+// ReadLines reads the lines of the container log until the reader fails or is closed, writing the lines
+// which pass the filters to the writer.
+//
+// If lines are grouped into multiline records a pending record is written once no lines have been read
+// for the flush delay so that the last record is not held back if the container hangs
+func (t *Tail) ReadLines(r io.Reader, writer *bufio.Writer) {
+	if t.Options.Multiline == nil {
+		reader := bufio.NewReader(r)
 		for {
+			// lets keep the last line even if it does not end with a new line
 			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				l := t.newHandledLine(line)
+				if t.Matches(l.Message) {
+					t.Print(writer, l)
+				}
+			}
 			if err != nil {
 				return
 			}
+		}
+	}
 
-			str := string(line)
+	grouper := &LineGrouper{Options: t.Options.Multiline}
+	delay := t.Options.Multiline.FlushDelay
+	if delay <= 0 {
+		delay = DefaultMultilineFlushDelay
+	}
+	idle := time.NewTimer(delay)
+	defer idle.Stop()
 
-			for _, rex := range t.Options.Exclude {
-				if rex.MatchString(str) {
-					continue OUTER
-				}
+	lines := make(chan []byte)
+	go func() {
+		defer close(lines)
+		reader := bufio.NewReader(r)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 {
+				lines <- line
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				t.printRecords(writer, grouper.Flush())
+				return
 			}
+			t.printRecords(writer, grouper.Add(t.newHandledLine(line)))
 
-			if len(t.Options.Include) != 0 {
-				matches := false
-				for _, rin := range t.Options.Include {
-					if rin.MatchString(str) {
-						matches = true
-						break
-					}
-				}
-				if !matches {
-					continue OUTER
+			if !idle.Stop() {
+				select {
+				case <-idle.C:
+				default:
 				}
 			}
+			idle.Reset(delay)
+		case <-idle.C:
+			if grouper.Pending() {
+				t.printRecords(writer, grouper.Flush())
+			}
+		}
+	}
+}
 
-			t.Print(writer, str)
+// newHandledLine creates the line from the text returned by kubernetes passing the masked message to the handlers
+func (t *Tail) newHandledLine(text []byte) *Line {
+	l := t.NewLine(string(text))
+	if len(t.Handlers) > 0 {
+		masked := t.masker.Mask(l.Message)
+		for _, h := range t.Handlers {
+			h.Line(masked)
 		}
-	}()
+	}
+	return l
+}
 
-	go func() {
-		<-ctx.Done()
-		close(t.closed)
-	}()
+// Matches returns true if the text of a line or multiline record passes the include and exclude filters
+func (t *Tail) Matches(text string) bool {
+	for _, rex := range t.Options.Exclude {
+		if rex.MatchString(text) {
+			return false
+		}
+	}
+	if len(t.Options.Include) == 0 {
+		return true
+	}
+	for _, rin := range t.Options.Include {
+		if rin.MatchString(text) {
+			return true
+		}
+	}
+	return false
 }
 
-// Close stops tailing
-func (t *Tail) Close() {
-	close(t.closed)
+// printRecords prints the lines of the multiline records which pass the filters
+func (t *Tail) printRecords(writer *bufio.Writer, records [][]*Line) {
+	for _, record := range records {
+		if !t.Matches(RecordText(record)) {
+			continue
+		}
+		for _, l := range record {
+			t.Print(writer, l)
+		}
+	}
+}
+
+// NewLine creates a line of the container log from the text returned by kubernetes,
+// splitting off the timestamp prefix and the trailing newline and sanitizing the message if enabled
+func (t *Tail) NewLine(text string) *Line {
+	l := &Line{
+		Namespace: t.Namespace,
+		Pod:       t.PodName,
+		Container: t.ContainerName,
+		Message:   strings.TrimRight(text, "\r\n"),
+	}
+	idx := strings.Index(l.Message, " ")
+	if idx > 0 {
+		ts, err := time.Parse(time.RFC3339Nano, l.Message[:idx])
+		if err == nil {
+			l.Timestamp = ts
+			l.Message = l.Message[idx+1:]
+		}
+	}
+	if t.Options.Sanitize {
+		l.Message = SanitizeLine(l.Message)
+	}
+	return l
 }
 
-// Print prints a line to the file
-func (t *Tail) Print(writer *bufio.Writer, msg string) {
-	masked := t.masker.Mask(msg)
-	writer.WriteString(masked)
+// Print prints a masked line to the file using the template if specified
+func (t *Tail) Print(writer *bufio.Writer, l *Line) {
+	masked := *l
+	masked.Message = t.masker.Mask(l.Message)
+	if masked.Message != l.Message {
+		metrics.MaskedLines.Inc()
+	}
+
+	text := t.Format(&masked)
+	writer.WriteString(text)
+	writer.WriteString("\n")
 	writer.Flush()
+	metrics.LinesWritten.WithLabelValues(t.Namespace).Inc()
+	metrics.BytesWritten.WithLabelValues(t.Namespace).Add(float64(len(text) + 1))
+
+	for _, o := range t.Outputs {
+		o.Write(&masked)
+	}
+}
+
+// Format formats a masked line as it is written to the file using the template if specified
+func (t *Tail) Format(l *Line) string {
+	switch {
+	case t.tmpl != nil:
+		buf := strings.Builder{}
+		err := t.tmpl.Execute(&buf, l)
+		if err != nil {
+			t.log.WithError(err).Debug("failed to execute line template")
+			return l.Message
+		}
+		return strings.TrimRight(buf.String(), "\n")
+	case t.Options.Timestamps && !l.Timestamp.IsZero():
+		return l.Timestamp.Format(time.RFC3339Nano) + " " + l.Message
+	default:
+		return l.Message
+	}
 }
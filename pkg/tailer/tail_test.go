@@ -0,0 +1,147 @@
+package tailer_test
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/jenkins-x-plugins/jx-secret/pkg/masker"
+	"github.com/jenkins-x/jx-test-collector/pkg/tailer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPrintWithTemplate(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	m := &masker.Client{
+		ReplaceWords: map[string]string{"s3cr3tvalue": "****"},
+	}
+	tmpl, err := template.New("line").Parse(`{{ .Timestamp.Format "15:04:05" }} {{ .Namespace }}/{{ .Pod }}/{{ .Container }} {{ .Message }}`)
+	require.NoError(t, err, "failed to parse template")
+
+	tail := tailer.NewTail(m, tmpDir, "jx", "mypod", "step-build", tmpl, &tailer.TailOptions{})
+
+	buf := strings.Builder{}
+	writer := bufio.NewWriter(&buf)
+	tail.Print(writer, tail.NewLine("2021-06-01T10:11:12.123456789Z logging in with s3cr3tvalue\n"))
+	tail.Print(writer, tail.NewLine("no timestamp\n"))
+
+	assert.Equal(t, "10:11:12 jx/mypod/step-build logging in with ****\n00:00:00 jx/mypod/step-build no timestamp\n", buf.String())
+
+	tail = tailer.NewTail(m, tmpDir, "jx", "mypod", "step-build", nil, &tailer.TailOptions{})
+	buf.Reset()
+	tail.Print(writer, tail.NewLine("2021-06-01T10:11:12.123456789Z logging in with s3cr3tvalue\n"))
+	assert.Equal(t, "logging in with ****\n", buf.String())
+}
+
+func TestSanitizeLine(t *testing.T) {
+	testCases := map[string]string{
+		"plain text":                                           "plain text",
+		"\x1b[32mPASS\x1b[0m: TestSomething":                   "PASS: TestSomething",
+		"\x1b[1;31merror\x1b[m at \x1b[4mmain.go\x1b[24m":      "error at main.go",
+		"\x1b]0;window title\x07building":                      "building",
+		"\x1b]8;;https://jenkins-x.io\x1b\\link\x1b]8;;\x1b\\": "link",
+		"downloading  10%\rdownloading  50%\rdownloading 100%": "downloading 100%",
+		"abcdef\rXY":                              "XYcdef",
+		"spinner -\b\\\b|":                        "spinner |",
+		"Downloading 10%\r\x1b[KDone":             "Done",
+		"Downloading 10%\r\x1b[0KDone":            "Done",
+		"\x1b[2K\rDownloading 50%\r\x1b[2K\rDone": "Done",
+		"abcdef\x1b[1K":                           "      ",
+		"abcdef\b\b\b\x1b[1KX":                    "   Xef",
+		"abc\x1b[32mdef\x1b[0m\rXY\x1b[K":         "XY",
+	}
+	for text, expected := range testCases {
+		assert.Equal(t, expected, tailer.SanitizeLine(text), "sanitized %q", text)
+	}
+
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	m := &masker.Client{
+		ReplaceWords: map[string]string{"s3cr3tvalue": "****"},
+	}
+	tail := tailer.NewTail(m, tmpDir, "jx", "mypod", "step-build", nil, &tailer.TailOptions{Sanitize: true})
+	l := tail.NewLine("2021-06-01T10:11:12.123456789Z \x1b[33mlogging in with s3c\x1b[0mr3tvalue\r\n")
+	assert.Equal(t, "logging in with s3cr3tvalue", l.Message, "sanitized message")
+
+	buf := strings.Builder{}
+	writer := bufio.NewWriter(&buf)
+	tail.Print(writer, l)
+	assert.Equal(t, "logging in with ****\n", buf.String(), "masked sanitized message")
+}
+
+func TestCompressTerminatedLog(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	pods := fake.NewSimpleClientset().CoreV1().Pods("jx")
+	options := &tailer.TailOptions{CompressMinBytes: 1}
+	waitDone := func(tail *tailer.Tail) {
+		select {
+		case <-tail.Done():
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "timed out waiting for the tail to finish")
+		}
+	}
+
+	// the fake log stream ends straight away as if it had been disconnected
+	runningDir := filepath.Join(tmpDir, "running")
+	tail := tailer.NewTail(&masker.Client{}, runningDir, "jx", "mypod", "step-build", nil, options)
+	tail.Start(context.Background(), pods)
+	waitDone(tail)
+
+	fileName := filepath.Join(runningDir, "step-build.log")
+	data, err := ioutil.ReadFile(fileName)
+	require.NoError(t, err, "the log of a running container should not be compressed when the stream ends")
+	assert.Equal(t, "fake logs\n", string(data), "log")
+	assert.NoFileExists(t, fileName+".gz")
+
+	// once the pod status shows the container has terminated the log is compressed
+	tail.ContainerTerminated()
+	assert.NoFileExists(t, fileName)
+	assert.FileExists(t, fileName+".gz")
+
+	terminatedDir := filepath.Join(tmpDir, "terminated")
+	tail = tailer.NewTail(&masker.Client{}, terminatedDir, "jx", "mypod", "step-build", nil, options)
+	tail.ContainerTerminated()
+	tail.Start(context.Background(), pods)
+	waitDone(tail)
+
+	fileName = filepath.Join(terminatedDir, "step-build.log")
+	assert.NoFileExists(t, fileName)
+	assert.FileExists(t, fileName+".gz", "the log of a terminated container should be compressed when the stream ends")
+}
+
+func TestContainerTerminated(t *testing.T) {
+	terminated := corev1.ContainerStatus{
+		Name: "step-build",
+		State: corev1.ContainerState{
+			Terminated: &corev1.ContainerStateTerminated{ExitCode: 1},
+		},
+	}
+	running := corev1.ContainerStatus{
+		Name:  "step-build",
+		State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}},
+	}
+
+	pod := &corev1.Pod{}
+	pod.Spec.RestartPolicy = corev1.RestartPolicyNever
+	assert.True(t, tailer.ContainerTerminated(pod, terminated), "terminated container which is never restarted")
+	assert.False(t, tailer.ContainerTerminated(pod, running), "running container")
+
+	pod.Spec.RestartPolicy = corev1.RestartPolicyAlways
+	pod.Status.Phase = corev1.PodRunning
+	assert.False(t, tailer.ContainerTerminated(pod, terminated), "terminated container which will be restarted")
+	pod.Status.Phase = corev1.PodFailed
+	assert.True(t, tailer.ContainerTerminated(pod, terminated), "terminated container of a failed pod")
+}
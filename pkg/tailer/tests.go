@@ -0,0 +1,363 @@
+package tailer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
+	"github.com/jenkins-x/jx-test-collector/pkg/junit"
+	"github.com/jenkins-x/jx-test-collector/pkg/testresults"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// PipelineRunLabel the label on tekton pods for the name of the PipelineRun
+	PipelineRunLabel = "tekton.dev/pipelineRun"
+
+	// PipelineTaskLabel the label on tekton pods for the name of the task in the pipeline
+	PipelineTaskLabel = "tekton.dev/pipelineTask"
+
+	// JUnitDir the directory within the pod log directory containing the JUnit reports
+	JUnitDir = "junit"
+
+	// JUnitSummaryFileName the name of the file in the pipeline run directory containing the summary of the tests
+	JUnitSummaryFileName = "junit-summary.json"
+
+	// CommitLabel the label on lighthouse pipeline pods for the git commit SHA being built
+	CommitLabel = "lighthouse.jenkins-x.io/lastCommitSHA"
+)
+
+var invalidFileNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// RunTestSummary the summary of the JUnit reports found in a pipeline run
+type RunTestSummary struct {
+	Namespace   string          `json:"namespace"`
+	PipelineRun string          `json:"pipelineRun,omitempty"`
+	Summary     junit.Summary   `json:"summary"`
+	Reports     []ReportSummary `json:"reports"`
+}
+
+// ReportSummary the summary of a single JUnit report
+type ReportSummary struct {
+	// Path the path of the report relative to the pipeline run directory
+	Path      string        `json:"path"`
+	Pod       string        `json:"pod"`
+	Container string        `json:"container"`
+	Source    string        `json:"source"`
+	Summary   junit.Summary `json:"summary"`
+}
+
+// tektonResult a result written by a tekton step into its termination message
+type tektonResult struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// TestCollector collects the JUnit XML reports in step logs and tekton task results
+// storing them next to the pod logs with a summary for each pipeline run
+type TestCollector struct {
+	// LogDir the directory pod logs are written to
+	LogDir string
+
+	lock sync.Mutex
+	pods map[string]*testPod
+}
+
+// testPod the state kept in memory for a pod until it is deleted
+type testPod struct {
+	// labels the labels of the pod used for the test results of its pipeline run
+	labels map[string]string
+
+	// results the tekton results which have been processed already
+	results map[string]bool
+}
+
+// testRunLabels the pod labels copied into the test results of a pipeline run
+var testRunLabels = []string{"owner", "repository", "branch", "build", CommitLabel}
+
+// testLineHandler extracts JUnit reports and parses test results from a container log
+type testLineHandler struct {
+	collector *TestCollector
+	target    *Target
+	junit     *junit.Extractor
+	parsers   map[string]testresults.Parser
+}
+
+// LineHandler returns a handler to extract JUnit reports and test results from the log of the given target
+func (c *TestCollector) LineHandler(target *Target) LineHandler {
+	count := 0
+	return &testLineHandler{
+		collector: c,
+		target:    target,
+		junit: &junit.Extractor{
+			OnReport: func(text string) {
+				count++
+				name := fmt.Sprintf("%s-%d", target.Container, count)
+				c.addReport(target, name, "log", text)
+			},
+		},
+		parsers: map[string]testresults.Parser{
+			"gotest": &testresults.GoTestParser{},
+			"tap":    &testresults.TAPParser{Suite: target.Container},
+		},
+	}
+}
+
+// Line processes the next line of the log
+func (h *testLineHandler) Line(line string) {
+	h.junit.Line(line)
+	for _, p := range h.parsers {
+		p.Line(line)
+	}
+}
+
+// Close saves any test results parsed from the log
+func (h *testLineHandler) Close() {
+	h.junit.Close()
+	for format, p := range h.parsers {
+		cases := p.Cases()
+		if len(cases) == 0 {
+			continue
+		}
+		source := strings.Join([]string{h.target.Pod, h.target.Container, format}, "/")
+		h.collector.addCases(h.target, source, cases)
+	}
+}
+
+// OnPod extracts any JUnit reports from the tekton results of the terminated containers in the pod
+func (c *TestCollector) OnPod(pod *corev1.Pod, path, runPath string, mask func(string) string) {
+	c.addPod(pod)
+
+	var statuses []corev1.ContainerStatus
+	statuses = append(statuses, pod.Status.InitContainerStatuses...)
+	statuses = append(statuses, pod.Status.ContainerStatuses...)
+	for i := range statuses {
+		s := &statuses[i]
+		t := s.State.Terminated
+		if t == nil || t.Message == "" {
+			continue
+		}
+		var results []tektonResult
+		err := json.Unmarshal([]byte(t.Message), &results)
+		if err != nil {
+			// not a tekton step
+			continue
+		}
+		target := &Target{
+			Namespace:   pod.Namespace,
+			Pod:         pod.Name,
+			Container:   s.Name,
+			Path:        path,
+			RunPath:     runPath,
+			PipelineRun: pod.Labels[PipelineRunLabel],
+		}
+		for _, r := range results {
+			if !junit.IsJUnit([]byte(r.Value)) || c.hasResult(pod, s.Name, r.Key) {
+				continue
+			}
+			c.addReport(target, s.Name+"-"+r.Key, "result", mask(r.Value))
+		}
+	}
+}
+
+// hasResult returns true if the result has been processed already, otherwise marks it as processed
+func (c *TestCollector) hasResult(pod *corev1.Pod, container, key string) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	p := c.pods[pod.Namespace+"/"+pod.Name]
+	if p == nil {
+		return false
+	}
+	if p.results == nil {
+		p.results = map[string]bool{}
+	}
+	id := string(pod.UID) + "/" + container + "/" + key
+	if p.results[id] {
+		return true
+	}
+	p.results[id] = true
+	return false
+}
+
+func (c *TestCollector) addReport(target *Target, name, source, text string) {
+	log := logrus.WithFields(map[string]interface{}{
+		"Namespace": target.Namespace,
+		"Pod":       target.Pod,
+		"Container": target.Container,
+	})
+	report, err := junit.Parse([]byte(text))
+	if err != nil {
+		log.WithError(err).Warn("failed to parse JUnit report")
+		return
+	}
+
+	podDir := filepath.Join(c.LogDir, target.Path)
+	dir := filepath.Join(podDir, JUnitDir)
+	err = os.MkdirAll(dir, files.DefaultDirWritePermissions)
+	if err != nil {
+		log.WithError(err).Errorf("failed to create dir: %s", dir)
+		return
+	}
+	fileName := filepath.Join(dir, invalidFileNameChars.ReplaceAllString(name, "_")+".xml")
+	err = ioutil.WriteFile(fileName, []byte(text), files.DefaultFileWritePermissions)
+	if err != nil {
+		log.WithError(err).Errorf("failed to save file %s", fileName)
+		return
+	}
+
+	runDir := filepath.Join(c.LogDir, target.RunPath)
+	path, err := filepath.Rel(runDir, fileName)
+	if err != nil {
+		path = fileName
+	}
+	path = filepath.ToSlash(path)
+	cases := testresults.FromJUnit(report)
+	for i := range cases {
+		cases[i].Pod = target.Pod
+		cases[i].Container = target.Container
+	}
+	c.addCases(target, path, cases)
+
+	err = c.addSummary(runDir, target, ReportSummary{
+		Path:      path,
+		Pod:       target.Pod,
+		Container: target.Container,
+		Source:    source,
+		Summary:   report.Summary(),
+	})
+	if err != nil {
+		log.WithError(err).Error("failed to save JUnit summary")
+	}
+}
+
+func (c *TestCollector) addSummary(runDir string, target *Target, report ReportSummary) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// the summary file is the only copy of the run so that nothing is kept in memory once it is written
+	fileName := filepath.Join(runDir, JUnitSummaryFileName)
+	run := &RunTestSummary{}
+	data, err := ioutil.ReadFile(fileName)
+	if err == nil {
+		err = json.Unmarshal(data, run)
+		if err != nil {
+			logrus.WithError(err).Warnf("failed to parse file %s", fileName)
+			run = &RunTestSummary{}
+		}
+	}
+	run.Namespace = target.Namespace
+	run.PipelineRun = target.PipelineRun
+
+	found := false
+	for i := range run.Reports {
+		if run.Reports[i].Path == report.Path {
+			run.Reports[i] = report
+			found = true
+			break
+		}
+	}
+	if !found {
+		run.Reports = append(run.Reports, report)
+	}
+	run.Summary = junit.Summary{}
+	for i := range run.Reports {
+		run.Summary.Add(run.Reports[i].Summary)
+	}
+
+	data, err = json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal JUnit summary")
+	}
+	err = os.MkdirAll(runDir, files.DefaultDirWritePermissions)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create directory %s", runDir)
+	}
+	err = ioutil.WriteFile(fileName, data, files.DefaultFileWritePermissions)
+	if err != nil {
+		return errors.Wrapf(err, "failed to save file %s", fileName)
+	}
+	return nil
+}
+
+// addPod remembers the labels of the pod so that they can be used for the test results of its pipeline run
+func (c *TestCollector) addPod(pod *corev1.Pod) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.pods == nil {
+		c.pods = map[string]*testPod{}
+	}
+	key := pod.Namespace + "/" + pod.Name
+	p := c.pods[key]
+	if p == nil {
+		p = &testPod{}
+		c.pods[key] = p
+	}
+	p.labels = map[string]string{}
+	for _, k := range testRunLabels {
+		if v := pod.Labels[k]; v != "" {
+			p.labels[k] = v
+		}
+	}
+}
+
+// OnPodDeleted forgets about a deleted pod. The reports and test results already written are kept
+func (c *TestCollector) OnPodDeleted(ns, name string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.pods, ns+"/"+name)
+}
+
+// Tracked returns the number of pods held in memory
+func (c *TestCollector) Tracked() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return len(c.pods)
+}
+
+// addCases replaces the test cases from the given source in the results of the pipeline run
+func (c *TestCollector) addCases(target *Target, source string, cases []testresults.Case) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	runDir := filepath.Join(c.LogDir, target.RunPath)
+	fileName := filepath.Join(runDir, testresults.FileName)
+	run, err := testresults.Load(fileName)
+	if err != nil {
+		// lets start again if there are no results written yet
+		run = &testresults.Run{}
+	}
+	run.Namespace = target.Namespace
+	run.PipelineRun = target.PipelineRun
+	pod := c.pods[target.Namespace+"/"+target.Pod]
+	if pod != nil {
+		run.Owner = pod.labels["owner"]
+		run.Repository = pod.labels["repository"]
+		run.Branch = pod.labels["branch"]
+		run.Build = pod.labels["build"]
+		run.Commit = pod.labels[CommitLabel]
+	}
+	for i := range cases {
+		if cases[i].Pod == "" {
+			cases[i].Pod = target.Pod
+			cases[i].Container = target.Container
+		}
+	}
+	run.Replace(source, cases)
+
+	err = run.Save(fileName)
+	if err != nil {
+		logrus.WithError(err).Error("failed to save test results")
+	}
+}
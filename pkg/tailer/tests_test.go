@@ -0,0 +1,98 @@
+package tailer_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/tailer"
+	"github.com/jenkins-x/jx-test-collector/pkg/testresults"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTestCollector(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+	t.Logf("running in dir %s", tmpDir)
+
+	report := `<testsuite name="mysuite" tests="2" failures="1"><testcase name="a"/><testcase name="b"><failure message="boom"/></testcase></testsuite>`
+	results, err := json.Marshal([]map[string]string{{"key": "report", "value": report}})
+	require.NoError(t, err, "failed to marshal results")
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "mypod",
+			Namespace: "jx",
+			UID:       "myuid",
+			Labels: map[string]string{
+				tailer.PipelineRunLabel: "myrun",
+				"owner":                 "myowner",
+				"repository":            "myrepo",
+				"branch":                "PR-1",
+				"build":                 "2",
+				"unrelated":             "ignored",
+			},
+		},
+		Status: corev1.PodStatus{
+			ContainerStatuses: []corev1.ContainerStatus{
+				{
+					Name: "step-test",
+					State: corev1.ContainerState{
+						Terminated: &corev1.ContainerStateTerminated{
+							Message: string(results),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	c := &tailer.TestCollector{LogDir: tmpDir}
+	mask := func(text string) string { return text }
+	c.OnPod(pod, "myrun/mypod", "myrun", mask)
+	assert.Equal(t, 1, c.Tracked(), "tracked pods")
+
+	assert.FileExists(t, filepath.Join(tmpDir, "myrun", "mypod", tailer.JUnitDir, "step-test-report.xml"))
+
+	run, err := testresults.Load(filepath.Join(tmpDir, "myrun", testresults.FileName))
+	require.NoError(t, err, "failed to load test results")
+	assert.Equal(t, "myowner", run.Owner)
+	assert.Equal(t, "myrepo", run.Repository)
+	assert.Equal(t, "PR-1", run.Branch)
+	assert.Equal(t, "2", run.Build)
+	require.Len(t, run.Cases, 2)
+
+	data, err := ioutil.ReadFile(filepath.Join(tmpDir, "myrun", tailer.JUnitSummaryFileName))
+	require.NoError(t, err, "failed to load JUnit summary")
+	summary := &tailer.RunTestSummary{}
+	require.NoError(t, json.Unmarshal(data, summary), "failed to parse JUnit summary")
+	require.Len(t, summary.Reports, 1)
+	assert.Equal(t, 2, summary.Summary.Tests)
+	assert.Equal(t, 1, summary.Summary.Failed)
+
+	// the same results are not processed again
+	c.OnPod(pod, "myrun/mypod", "myrun", mask)
+	run, err = testresults.Load(filepath.Join(tmpDir, "myrun", testresults.FileName))
+	require.NoError(t, err, "failed to load test results")
+	assert.Len(t, run.Cases, 2)
+
+	c.OnPodDeleted(pod.Namespace, pod.Name)
+	assert.Equal(t, 0, c.Tracked(), "tracked pods after the pod is deleted")
+
+	// a second pod in the same run adds to the results written by the first
+	pod2 := pod.DeepCopy()
+	pod2.Name = "mypod2"
+	pod2.UID = "myuid2"
+	c.OnPod(pod2, "myrun/mypod2", "myrun", mask)
+
+	data, err = ioutil.ReadFile(filepath.Join(tmpDir, "myrun", tailer.JUnitSummaryFileName))
+	require.NoError(t, err, "failed to load JUnit summary")
+	summary = &tailer.RunTestSummary{}
+	require.NoError(t, json.Unmarshal(data, summary), "failed to parse JUnit summary")
+	assert.Len(t, summary.Reports, 2)
+	assert.Equal(t, 4, summary.Summary.Tests)
+}
@@ -20,9 +20,11 @@ package tailer
 import (
 	"context"
 	"fmt"
-	"path/filepath"
+	"time"
 
+	"github.com/jenkins-x/jx-test-collector/pkg/metrics"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -31,12 +33,30 @@ import (
 	"k8s.io/client-go/kubernetes/typed/core/v1"
 )
 
+// maxRewatchDelay the maximum delay between attempts to reconnect the pod watch
+const maxRewatchDelay = time.Minute
+
 // Target is a target to watch
 type Target struct {
 	Namespace string
 	Pod       string
 	Container string
 	App       string
+
+	// Path the directory of the pod log files relative to the log directory
+	Path string
+
+	// RunPath the directory of the pipeline run files relative to the log directory
+	RunPath string
+
+	// PipelineRun the name of the tekton PipelineRun if the pod is part of a pipeline
+	PipelineRun string
+
+	// Task the name of the tekton pipeline task if the pod is part of a pipeline
+	Task string
+
+	// Terminated true if the pod status shows that the container has terminated and will not be restarted
+	Terminated bool
 }
 
 // GetID returns the ID of the object
@@ -44,11 +64,43 @@ func (t *Target) GetID() string {
 	return fmt.Sprintf("%s-%s-%s", t.Namespace, t.Pod, t.Container)
 }
 
+// newTarget creates the target of a container of the pod whose log files are in the given paths
+func newTarget(pod *corev1.Pod, container, path, runPath string) *Target {
+	return &Target{
+		Namespace: pod.Namespace,
+		Pod:       pod.Name,
+		Container: container,
+		App:       AppPath(pod),
+		Path:      path,
+		RunPath:   runPath,
+
+		PipelineRun: pod.Labels[PipelineRunLabel],
+		Task:        pod.Labels[PipelineTaskLabel],
+	}
+}
+
+// ContainerTerminated returns true if the container has terminated and will not be restarted
+func ContainerTerminated(pod *corev1.Pod, c corev1.ContainerStatus) bool {
+	if c.State.Terminated == nil {
+		return false
+	}
+	switch pod.Spec.RestartPolicy {
+	case corev1.RestartPolicyNever:
+		return true
+	case corev1.RestartPolicyOnFailure:
+		if c.State.Terminated.ExitCode == 0 {
+			return true
+		}
+	}
+	return pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed
+}
+
 // Watch starts listening to Kubernetes events and emits modified
 // containers/pods. The first result is targets added, the second is targets
 // removed
 func (o *Options) Watch(ctx context.Context, i v1.PodInterface, labelSelector labels.Selector) (chan *Target, chan *Target, error) {
-	watcher, err := i.Watch(ctx, metav1.ListOptions{Watch: true, LabelSelector: labelSelector.String()})
+	listOptions := metav1.ListOptions{Watch: true, LabelSelector: labelSelector.String()}
+	watcher, err := i.Watch(ctx, listOptions)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "failed to set up watch")
 	}
@@ -56,17 +108,30 @@ func (o *Options) Watch(ctx context.Context, i v1.PodInterface, labelSelector la
 	added := make(chan *Target)
 	removed := make(chan *Target)
 
+	o.Health.Watching(true)
 	go func() {
+		defer o.Health.WatchStopped()
 		for {
 			select {
-			case e := <-watcher.ResultChan():
-				if e.Object == nil {
-					// Closed because of error
-					return
+			case e, ok := <-watcher.ResultChan():
+				if !ok || e.Object == nil || e.Type == watch.Error {
+					// closed because of an error or a server side timeout so lets watch again
+					watcher.Stop()
+					o.Health.Watching(false)
+					watcher = rewatch(ctx, "pod", func() (watch.Interface, error) {
+						return i.Watch(ctx, listOptions)
+					})
+					if watcher == nil {
+						close(added)
+						close(removed)
+						return
+					}
+					o.Health.Watching(true)
+					continue
 				}
 
-				pod := e.Object.(*corev1.Pod)
-				if pod == nil {
+				pod, ok := e.Object.(*corev1.Pod)
+				if !ok || pod == nil {
 					continue
 				}
 
@@ -74,8 +139,23 @@ func (o *Options) Watch(ctx context.Context, i v1.PodInterface, labelSelector la
 					continue
 				}
 
+				o.onPod(pod, e.Type)
+
 				switch e.Type {
 				case watch.Added, watch.Modified:
+					path := o.layout().PodPath(pod)
+					runPath := o.layout().RunPath(pod)
+					err := o.savePodMetadata(pod, path)
+					if err != nil {
+						logrus.WithError(err).WithFields(map[string]interface{}{
+							"Namespace": pod.Namespace,
+							"Pod":       pod.Name,
+						}).Warn("failed to save pod metadata")
+					}
+					if o.tests != nil {
+						o.tests.OnPod(pod, path, runPath, o.mask)
+					}
+
 					var statuses []corev1.ContainerStatus
 					statuses = append(statuses, pod.Status.InitContainerStatuses...)
 					statuses = append(statuses, pod.Status.ContainerStatuses...)
@@ -85,35 +165,20 @@ func (o *Options) Watch(ctx context.Context, i v1.PodInterface, labelSelector la
 							continue
 						}
 
-						app := ""
-						if pod.Labels != nil {
-							app = pod.Labels["app"]
-							if app == "" {
-								app = pod.Labels["app.kubernetes.io/managed-by"]
-							}
-							if app == "tekton-pipelines" {
-								owner := pod.Labels["owner"]
-								repository := pod.Labels["repository"]
-								branch := pod.Labels["branch"]
-								if owner != "" {
-									app = filepath.Join(app, owner)
-								}
-								if repository != "" {
-									app = filepath.Join(app, repository)
-								}
-								if branch != "" {
-									app = filepath.Join(app, branch)
-								}
-							}
-						}
-						added <- &Target{
-							Namespace: pod.Namespace,
-							Pod:       pod.Name,
-							Container: c.Name,
-							App:       app,
-						}
+						target := newTarget(pod, c.Name, path, runPath)
+						target.Terminated = ContainerTerminated(pod, c)
+						added <- target
 					}
 				case watch.Deleted:
+					if o.events != nil {
+						o.events.OnPodDeleted(pod.Namespace, pod.Name)
+					}
+					if o.tests != nil {
+						o.tests.OnPodDeleted(pod.Namespace, pod.Name)
+					}
+					o.streams.OnPodDeleted(pod.Namespace, pod.Name)
+					path := o.layout().PodPath(pod)
+					runPath := o.layout().RunPath(pod)
 					var containers []corev1.Container
 					containers = append(containers, pod.Spec.Containers...)
 					containers = append(containers, pod.Spec.InitContainers...)
@@ -123,11 +188,7 @@ func (o *Options) Watch(ctx context.Context, i v1.PodInterface, labelSelector la
 							continue
 						}
 
-						removed <- &Target{
-							Namespace: pod.Namespace,
-							Pod:       pod.Name,
-							Container: c.Name,
-						}
+						removed <- newTarget(pod, c.Name, path, runPath)
 					}
 				}
 			case <-ctx.Done():
@@ -141,3 +202,27 @@ func (o *Options) Watch(ctx context.Context, i v1.PodInterface, labelSelector la
 
 	return added, removed, nil
 }
+
+// rewatch sets up the named watch again backing off on failures until it succeeds or the context is done
+// in which case nil is returned
+func rewatch(ctx context.Context, name string, fn func() (watch.Interface, error)) watch.Interface {
+	delay := time.Second
+	for {
+		watcher, err := fn()
+		if err == nil {
+			metrics.WatchReconnects.Inc()
+			logrus.Infof("reconnected the %s watch", name)
+			return watcher
+		}
+		logrus.WithError(err).Warnf("failed to reconnect the %s watch, retrying in %s", name, delay.String())
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+		delay *= 2
+		if delay > maxRewatchDelay {
+			delay = maxRewatchDelay
+		}
+	}
+}
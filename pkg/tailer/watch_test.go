@@ -0,0 +1,57 @@
+package tailer_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/metrics"
+	"github.com/jenkins-x/jx-test-collector/pkg/tailer"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestWatchReconnects(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	first := watch.NewFake()
+	var lock sync.Mutex
+	calls := 0
+	kubeClient.PrependWatchReactor("pods", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		lock.Lock()
+		defer lock.Unlock()
+		calls++
+		switch calls {
+		case 1:
+			return true, first, nil
+		case 2:
+			return true, nil, errors.Errorf("connection refused")
+		}
+		return true, watch.NewFake(), nil
+	})
+
+	before := testutil.ToFloat64(metrics.WatchReconnects)
+	o := &tailer.Options{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, _, err := o.Watch(ctx, kubeClient.CoreV1().Pods("jx"), labels.Everything())
+	require.NoError(t, err, "failed to watch pods")
+
+	// closing the watch makes the watcher reconnect after a failed attempt
+	first.Stop()
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return calls == 3
+	}, 5*time.Second, 10*time.Millisecond, "should reconnect the watch")
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(metrics.WatchReconnects) > before
+	}, 5*time.Second, 10*time.Millisecond, "should count the reconnect")
+	assert.Equal(t, before+1, testutil.ToFloat64(metrics.WatchReconnects), "the failed attempt should not be counted")
+}
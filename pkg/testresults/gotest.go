@@ -0,0 +1,91 @@
+package testresults
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// goTestEvent an event written by `go test -json` (see `go doc test2json`)
+type goTestEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Elapsed float64
+	Output  string
+}
+
+// GoTestParser parses the output of `go test -json`
+type GoTestParser struct {
+	cases   []Case
+	outputs map[string]*strings.Builder
+	tested  map[string]bool
+}
+
+// Line processes the next line of the log
+func (p *GoTestParser) Line(line string) {
+	idx := strings.Index(line, `{"Time"`)
+	if idx < 0 {
+		idx = strings.Index(line, `{"Action"`)
+		if idx < 0 {
+			return
+		}
+	}
+	e := goTestEvent{}
+	err := json.Unmarshal([]byte(line[idx:]), &e)
+	if err != nil || e.Action == "" || e.Package == "" {
+		return
+	}
+	if p.outputs == nil {
+		p.outputs = map[string]*strings.Builder{}
+		p.tested = map[string]bool{}
+	}
+	key := e.Package + "\n" + e.Test
+
+	switch e.Action {
+	case "output":
+		buf := p.outputs[key]
+		if buf == nil {
+			buf = &strings.Builder{}
+			p.outputs[key] = buf
+		}
+		buf.WriteString(e.Output)
+
+	case "pass", "fail", "skip":
+		status := StatusPassed
+		switch e.Action {
+		case "fail":
+			status = StatusFailed
+		case "skip":
+			status = StatusSkipped
+		}
+		if e.Test != "" {
+			p.tested[e.Package] = true
+		} else if status != StatusFailed || p.tested[e.Package] {
+			// package level results are only reported if the package failed without any tests such as build failures
+			delete(p.outputs, key)
+			return
+		}
+
+		c := Case{
+			Suite:    e.Package,
+			Name:     e.Test,
+			Status:   status,
+			Duration: e.Elapsed,
+			Format:   "gotest",
+		}
+		if c.Name == "" {
+			c.Name = e.Package
+			c.Status = StatusError
+		}
+		if buf := p.outputs[key]; buf != nil && status != StatusPassed {
+			c.Output = buf.String()
+		}
+		delete(p.outputs, key)
+		p.cases = append(p.cases, c)
+	}
+}
+
+// Cases returns the test cases found so far
+func (p *GoTestParser) Cases() []Case {
+	return p.cases
+}
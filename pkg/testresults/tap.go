@@ -0,0 +1,164 @@
+package testresults
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	tapVersion   = regexp.MustCompile(`^TAP version \d+`)
+	tapPlan      = regexp.MustCompile(`^1\.\.\d+`)
+	tapTestLine  = regexp.MustCompile(`^(not ok|ok)\b\s*(\d+)?\s*(?:-\s*)?([^#]*)(?:#\s*(\w+)\b\s*(.*))?$`)
+	tapBailOut   = regexp.MustCompile(`^Bail out!\s*(.*)$`)
+	tapSubtest   = regexp.MustCompile(`^# Subtest:\s*(.*)$`)
+	tapYAMLStart = regexp.MustCompile(`^\s+---\s*$`)
+	tapYAMLEnd   = regexp.MustCompile(`^\s+\.\.\.\s*$`)
+)
+
+// tapIndent the indentation of each level of subtests
+const tapIndent = 4
+
+// TAPParser parses the Test Anything Protocol output of a log.
+//
+// Test lines are only recognised after a TAP version or plan line so that other
+// log lines beginning with `ok` are ignored.
+//
+// The indented results of subtests are named after the enclosing tests using the names of the
+// `# Subtest:` comments separated by `/` like go subtests
+type TAPParser struct {
+	// Suite the default name of the suite for test cases
+	Suite string
+
+	cases   []Case
+	started int
+	active  bool
+	inYAML  bool
+
+	// subtests the names of the subtests indexed by the depth of their results
+	subtests     []string
+	pending      string
+	pendingDepth int
+}
+
+// Line processes the next line of the log
+func (p *TAPParser) Line(line string) {
+	line = strings.TrimRight(line, "\r\n")
+	if tapVersion.MatchString(line) {
+		p.active = true
+		p.started = len(p.cases)
+		return
+	}
+	if tapPlan.MatchString(line) {
+		// a trailing plan ends the current TAP stream
+		p.active = !p.active || len(p.cases) == p.started
+		p.started = len(p.cases)
+		return
+	}
+	if !p.active {
+		return
+	}
+
+	if p.inYAML {
+		if tapYAMLEnd.MatchString(line) {
+			p.inYAML = false
+			return
+		}
+		p.appendOutput(strings.TrimSpace(line))
+		return
+	}
+	if tapYAMLStart.MatchString(line) && len(p.cases) > 0 {
+		p.inYAML = true
+		return
+	}
+
+	trimmed := strings.TrimLeft(line, " ")
+	depth := (len(line) - len(trimmed)) / tapIndent
+	if m := tapSubtest.FindStringSubmatch(trimmed); m != nil {
+		// the results of the subtest are indented one more level than the comment
+		p.pending = strings.TrimSpace(m[1])
+		p.pendingDepth = depth + 1
+		return
+	}
+	if m := tapBailOut.FindStringSubmatch(trimmed); m != nil {
+		p.cases = append(p.cases, Case{
+			Suite:  p.Suite,
+			Name:   "Bail out!",
+			Status: StatusError,
+			Output: m[1],
+			Format: "tap",
+		})
+		p.active = false
+		return
+	}
+
+	m := tapTestLine.FindStringSubmatch(trimmed)
+	if m == nil {
+		return
+	}
+	c := Case{
+		Suite:  p.Suite,
+		Name:   strings.TrimSpace(m[3]),
+		Status: StatusPassed,
+		Format: "tap",
+	}
+	if c.Name == "" {
+		c.Name = m[2]
+	}
+	if prefix := p.subtestPrefix(depth); prefix != "" {
+		c.Name = prefix + "/" + c.Name
+	}
+	if m[1] == "not ok" {
+		c.Status = StatusFailed
+	}
+	switch strings.ToUpper(m[4]) {
+	case "SKIP":
+		c.Status = StatusSkipped
+		c.Output = strings.TrimSpace(m[5])
+	case "TODO":
+		// failing TODO tests are not treated as failures
+		c.Status = StatusSkipped
+		c.Output = strings.TrimSpace(m[5])
+	}
+	p.cases = append(p.cases, c)
+}
+
+// Cases returns the test cases found so far
+func (p *TAPParser) Cases() []Case {
+	return p.cases
+}
+
+// subtestPrefix returns the names of the enclosing subtests of a result at the given depth
+func (p *TAPParser) subtestPrefix(depth int) string {
+	if p.pending != "" {
+		if depth == p.pendingDepth {
+			for len(p.subtests) <= depth {
+				p.subtests = append(p.subtests, "")
+			}
+			p.subtests[depth] = p.pending
+		}
+		p.pending = ""
+	}
+	// lets forget the names of any deeper subtests which have completed
+	if len(p.subtests) > depth+1 {
+		p.subtests = p.subtests[:depth+1]
+	}
+
+	var names []string
+	for i := 1; i <= depth && i < len(p.subtests); i++ {
+		if p.subtests[i] != "" {
+			names = append(names, p.subtests[i])
+		}
+	}
+	return strings.Join(names, "/")
+}
+
+func (p *TAPParser) appendOutput(text string) {
+	c := &p.cases[len(p.cases)-1]
+	if c.Status == StatusPassed {
+		return
+	}
+	if c.Output != "" {
+		c.Output += "\n"
+	}
+	c.Output += text
+}
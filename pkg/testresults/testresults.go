@@ -0,0 +1,214 @@
+package testresults
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
+	"github.com/jenkins-x/jx-test-collector/pkg/junit"
+	"github.com/pkg/errors"
+)
+
+const (
+	// FileName the name of the file in the pipeline run directory containing the test results
+	FileName = "test-results.json"
+)
+
+// Status the status of a test case
+type Status string
+
+const (
+	// StatusPassed the test passed
+	StatusPassed Status = "passed"
+
+	// StatusFailed the test failed
+	StatusFailed Status = "failed"
+
+	// StatusError the test could not be run or errored
+	StatusError Status = "error"
+
+	// StatusSkipped the test was skipped
+	StatusSkipped Status = "skipped"
+)
+
+// Run the normalized test results of a pipeline run
+type Run struct {
+	Namespace   string  `json:"namespace"`
+	PipelineRun string  `json:"pipelineRun,omitempty"`
+	Owner       string  `json:"owner,omitempty"`
+	Repository  string  `json:"repository,omitempty"`
+	Branch      string  `json:"branch,omitempty"`
+	Build       string  `json:"build,omitempty"`
+	Commit      string  `json:"commit,omitempty"`
+	Summary     Summary `json:"summary"`
+	Cases       []Case  `json:"cases"`
+}
+
+// Case the result of a single test case
+type Case struct {
+	Suite  string `json:"suite,omitempty"`
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+
+	// Duration the duration of the test in seconds
+	Duration float64 `json:"duration"`
+
+	// Output the output of the test; only captured for tests which did not pass
+	Output string `json:"output,omitempty"`
+
+	// Format the format the result was parsed from such as junit, gotest or tap
+	Format string `json:"format,omitempty"`
+
+	Pod       string `json:"pod,omitempty"`
+	Container string `json:"container,omitempty"`
+
+	// Source identifies the log or report the case was parsed from
+	Source string `json:"source,omitempty"`
+}
+
+// Summary the number of test cases by status
+type Summary struct {
+	Tests   int `json:"tests"`
+	Passed  int `json:"passed"`
+	Failed  int `json:"failed"`
+	Errors  int `json:"errors"`
+	Skipped int `json:"skipped"`
+}
+
+// Parser parses test results from the lines of a log
+type Parser interface {
+	// Line processes the next line of the log
+	Line(line string)
+
+	// Cases returns the test cases found so far
+	Cases() []Case
+}
+
+// Replace replaces any cases from the given source and updates the summary
+func (r *Run) Replace(source string, cases []Case) {
+	var answer []Case
+	for i := range r.Cases {
+		if r.Cases[i].Source != source {
+			answer = append(answer, r.Cases[i])
+		}
+	}
+	for i := range cases {
+		c := cases[i]
+		c.Source = source
+		answer = append(answer, c)
+	}
+	r.Cases = answer
+	r.Summary = Summarize(r.Cases)
+}
+
+// Summarize returns the summary of the given cases
+func Summarize(cases []Case) Summary {
+	answer := Summary{}
+	for i := range cases {
+		answer.Tests++
+		switch cases[i].Status {
+		case StatusPassed:
+			answer.Passed++
+		case StatusFailed:
+			answer.Failed++
+		case StatusError:
+			answer.Errors++
+		case StatusSkipped:
+			answer.Skipped++
+		}
+	}
+	return answer
+}
+
+// FromJUnit converts the JUnit test suites into test cases
+func FromJUnit(suites *junit.TestSuites) []Case {
+	var answer []Case
+	for i := range suites.Suites {
+		answer = appendJUnitSuite(answer, &suites.Suites[i])
+	}
+	return answer
+}
+
+func appendJUnitSuite(answer []Case, suite *junit.TestSuite) []Case {
+	for i := range suite.Suites {
+		answer = appendJUnitSuite(answer, &suite.Suites[i])
+	}
+	for i := range suite.Cases {
+		tc := &suite.Cases[i]
+		c := Case{
+			Suite:    suite.Name,
+			Name:     tc.Name,
+			Status:   StatusPassed,
+			Duration: tc.Time,
+			Format:   "junit",
+		}
+		if c.Suite == "" {
+			c.Suite = tc.ClassName
+		}
+		var result *junit.Result
+		switch {
+		case tc.Failure != nil:
+			c.Status = StatusFailed
+			result = tc.Failure
+		case tc.Error != nil:
+			c.Status = StatusError
+			result = tc.Error
+		case tc.Skipped != nil:
+			c.Status = StatusSkipped
+			result = tc.Skipped
+		}
+		if result != nil {
+			c.Output = joinLines(result.Message, result.Body, tc.SystemOut, tc.SystemErr)
+		}
+		answer = append(answer, c)
+	}
+	return answer
+}
+
+// Load loads the test results from the given file
+func Load(fileName string) (*Run, error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load file %s", fileName)
+	}
+	answer := &Run{}
+	err = json.Unmarshal(data, answer)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse file %s", fileName)
+	}
+	return answer, nil
+}
+
+// Save saves the test results to the given file
+func (r *Run) Save(fileName string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal test results")
+	}
+	dir := filepath.Dir(fileName)
+	err = os.MkdirAll(dir, files.DefaultDirWritePermissions)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create directory %s", dir)
+	}
+	err = ioutil.WriteFile(fileName, data, files.DefaultFileWritePermissions)
+	if err != nil {
+		return errors.Wrapf(err, "failed to save file %s", fileName)
+	}
+	return nil
+}
+
+func joinLines(values ...string) string {
+	answer := ""
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		if answer != "" {
+			answer += "\n"
+		}
+		answer += v
+	}
+	return answer
+}
@@ -0,0 +1,104 @@
+package testresults_test
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/testresults"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGoTestParser(t *testing.T) {
+	p := &testresults.GoTestParser{}
+	cases := parseFile(t, p, "gotest.log")
+
+	summary := testresults.Summarize(cases)
+	assert.Equal(t, testresults.Summary{Tests: 4, Passed: 1, Failed: 1, Errors: 1, Skipped: 1}, summary, "summary")
+
+	for _, c := range cases {
+		switch c.Name {
+		case "TestBrie":
+			assert.Equal(t, "github.com/example/cheese", c.Suite, "suite")
+			assert.Equal(t, 0.2, c.Duration, "duration")
+			assert.Contains(t, c.Output, "expected brie to be runny", "output")
+		case "TestEdam":
+			assert.Empty(t, c.Output, "output of passing test")
+		case "github.com/example/broken":
+			assert.Contains(t, c.Output, "syntax error", "output")
+		}
+	}
+}
+
+func TestTAPParser(t *testing.T) {
+	p := &testresults.TAPParser{Suite: "test"}
+	cases := parseFile(t, p, "tap.log")
+
+	require.Len(t, cases, 3, "cases")
+	assert.Equal(t, testresults.StatusFailed, cases[1].Status, "status")
+	assert.Equal(t, "submits the form", cases[1].Name, "name")
+	assert.Contains(t, cases[1].Output, "expected 200 got 500", "output")
+	assert.Equal(t, testresults.StatusSkipped, cases[2].Status, "status")
+	assert.Equal(t, "test", cases[2].Suite, "suite")
+}
+
+func TestTAPParserSubtests(t *testing.T) {
+	p := &testresults.TAPParser{Suite: "test"}
+	cases := parseFile(t, p, "tap-subtests.log")
+
+	statuses := map[string]testresults.Status{}
+	for _, c := range cases {
+		assert.Equal(t, "test", c.Suite, "suite of %s", c.Name)
+		statuses[c.Name] = c.Status
+	}
+	assert.Equal(t, map[string]testresults.Status{
+		"checkout/loads the cart":           testresults.StatusPassed,
+		"checkout/applies the discount":     testresults.StatusFailed,
+		"checkout/payment/charges the card": testresults.StatusFailed,
+		"checkout/payment":                  testresults.StatusFailed,
+		"checkout":                          testresults.StatusFailed,
+		"renders the footer":                testresults.StatusPassed,
+	}, statuses, "cases")
+
+	require.Len(t, cases, 6, "cases")
+	assert.Contains(t, cases[1].Output, "expected 10 got 0", "output of the failed subtest")
+
+	summary := testresults.Summarize(cases)
+	assert.Equal(t, testresults.Summary{Tests: 6, Passed: 2, Failed: 4}, summary, "summary")
+}
+
+func TestTAPParserIgnoresLogsWithoutPlan(t *testing.T) {
+	p := &testresults.TAPParser{}
+	p.Line("ok 1 - not a TAP stream\n")
+	assert.Empty(t, p.Cases(), "cases")
+}
+
+func TestRunReplace(t *testing.T) {
+	r := &testresults.Run{}
+	r.Replace("a", []testresults.Case{{Name: "x", Status: testresults.StatusFailed}})
+	r.Replace("b", []testresults.Case{{Name: "y", Status: testresults.StatusPassed}})
+	r.Replace("a", []testresults.Case{{Name: "x", Status: testresults.StatusPassed}})
+
+	assert.Equal(t, testresults.Summary{Tests: 2, Passed: 2}, r.Summary, "summary")
+}
+
+func parseFile(t *testing.T, p testresults.Parser, name string) []testresults.Case {
+	path := filepath.Join("test_data", name)
+	f, err := os.Open(path)
+	require.NoError(t, err, "failed to open %s", path)
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			p.Line(line)
+		}
+		if err != nil {
+			break
+		}
+	}
+	return p.Cases()
+}
@@ -0,0 +1,282 @@
+package web
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/gitstore"
+	"github.com/jenkins-x/jx-test-collector/pkg/logfiles"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// APIPath the URL path prefix of the versioned JSON REST API
+	APIPath = "/api/v1/"
+
+	// APITargetsPath lists the containers being tailed
+	APITargetsPath = APIPath + "targets"
+
+	// APIResourcesPath fetches a resource using the path {group}/{version}/{resource}/[{namespace}/]{name}
+	APIResourcesPath = APIPath + "resources/"
+
+	// APISyncsPath lists the history of syncs
+	APISyncsPath = APIPath + "syncs"
+
+	// DefaultSyncHistorySize the default number of syncs kept in the history
+	DefaultSyncHistorySize = 20
+)
+
+// TargetLister lists the containers whose logs are being collected
+type TargetLister interface {
+	// Targets returns the status of the containers
+	Targets() []*TargetStatus
+}
+
+// TargetStatus the status of the collection of a container log
+type TargetStatus struct {
+	Namespace   string `json:"namespace"`
+	Pod         string `json:"pod"`
+	Container   string `json:"container"`
+	App         string `json:"app,omitempty"`
+	Path        string `json:"path"`
+	RunPath     string `json:"runPath,omitempty"`
+	PipelineRun string `json:"pipelineRun,omitempty"`
+	Task        string `json:"task,omitempty"`
+
+	// Tailing is true if the log is still being written
+	Tailing bool `json:"tailing"`
+
+	// Lines the number of lines written to the log
+	Lines int `json:"lines"`
+
+	// Bytes the number of bytes written to the log before any truncation or compression
+	Bytes int64 `json:"bytes"`
+
+	// LogFile the file name of the log relative to the work directory
+	LogFile string `json:"logFile"`
+
+	// FileBytes the size of the log file on disk
+	FileBytes int64 `json:"fileBytes"`
+
+	// Started when the log started being written
+	Started time.Time `json:"started"`
+}
+
+// SyncRecord the result of a sync
+type SyncRecord struct {
+	*gitstore.SyncResult
+
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// SyncStatus the most recent syncs and when the next sync is scheduled
+type SyncStatus struct {
+	// NextSync when the next periodic sync is scheduled if the sync loop is running
+	NextSync *time.Time `json:"nextSync,omitempty"`
+
+	// Syncs the most recent syncs with the most recent first
+	Syncs []*SyncRecord `json:"syncs"`
+}
+
+// SyncHistory the most recent syncs
+type SyncHistory struct {
+	// Size the number of syncs kept. Defaults to DefaultSyncHistorySize
+	Size int `env:"SYNC_HISTORY_SIZE"`
+
+	lock     sync.Mutex
+	records  []*SyncRecord
+	nextSync time.Time
+}
+
+// Add adds the result of a sync to the history
+func (h *SyncHistory) Add(started time.Time, result *gitstore.SyncResult, err error) *SyncRecord {
+	if result == nil {
+		result = &gitstore.SyncResult{}
+	}
+	r := &SyncRecord{
+		SyncResult: result,
+		Started:    started,
+		Duration:   time.Since(started),
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	size := h.Size
+	if size <= 0 {
+		size = DefaultSyncHistorySize
+	}
+	h.records = append(h.records, r)
+	if len(h.records) > size {
+		h.records = h.records[len(h.records)-size:]
+	}
+	return r
+}
+
+// Records returns the syncs with the most recent first
+func (h *SyncHistory) Records() []*SyncRecord {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	answer := make([]*SyncRecord, 0, len(h.records))
+	for i := len(h.records) - 1; i >= 0; i-- {
+		answer = append(answer, h.records[i])
+	}
+	return answer
+}
+
+// SetNextSync records when the next periodic sync is scheduled
+func (h *SyncHistory) SetNextSync(t time.Time) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.nextSync = t
+}
+
+// Status returns at most limit of the most recent syncs and when the next sync is scheduled.
+// A limit of zero returns all of the syncs in the history
+func (h *SyncHistory) Status(limit int) *SyncStatus {
+	records := h.Records()
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	answer := &SyncStatus{
+		Syncs: records,
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if !h.nextSync.IsZero() {
+		t := h.nextSync
+		answer.NextSync = &t
+	}
+	return answer
+}
+
+// targets lists the containers being tailed optionally filtered by the namespace and pod query parameters
+func (o *Options) targets(w http.ResponseWriter, r *http.Request) {
+	ns := r.URL.Query().Get("namespace")
+	pod := r.URL.Query().Get("pod")
+	answer := []*TargetStatus{}
+	if o.Targets != nil {
+		for _, t := range o.Targets.Targets() {
+			if (ns != "" && t.Namespace != ns) || (pod != "" && t.Pod != pod) {
+				continue
+			}
+			targetFileBytes(t)
+			if o.Dir != "" {
+				t.LogFile = relativeTo(o.Dir, t.LogFile)
+			}
+			answer = append(answer, t)
+		}
+	}
+	writeJSON(w, http.StatusOK, answer)
+}
+
+// resource returns the JSON of a resource from the dumped resource YAML files
+func (o *Options) resource(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, APIResourcesPath), "/"), "/")
+	if len(parts) < 4 || len(parts) > 5 {
+		writeError(w, http.StatusBadRequest, "expected path "+APIResourcesPath+"{group}/{version}/{resource}/[{namespace}/]{name}")
+		return
+	}
+	if o.ResourceFile == nil {
+		writeError(w, http.StatusNotFound, "resources are not available")
+		return
+	}
+	ns := ""
+	if len(parts) == 5 {
+		ns = parts[3]
+	}
+	name := parts[len(parts)-1]
+	fileName, err := o.ResourceFile(parts[0], parts[1], parts[2], ns, name)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			writeError(w, http.StatusNotFound, "resource not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to load resource: "+err.Error())
+		return
+	}
+	data, err = yaml.YAMLToJSON(data)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to convert resource to JSON: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// syncs returns the history of syncs
+func (o *Options) syncs(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, o.History.Records())
+}
+
+// syncStatus returns the most recent syncs, limited by the optional limit query parameter, and the next scheduled sync
+func (o *Options) syncStatus(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if text := r.URL.Query().Get("limit"); text != "" {
+		var err error
+		limit, err = strconv.Atoi(text)
+		if err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit "+text)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, o.History.Status(limit))
+}
+
+// targetFileBytes adds the size of the log file to the status
+func targetFileBytes(t *TargetStatus) {
+	for _, fileName := range []string{t.LogFile, t.LogFile + logfiles.GzipExtension} {
+		info, err := os.Stat(fileName)
+		if err == nil {
+			t.FileBytes = info.Size()
+			return
+		}
+	}
+}
+
+// relativeTo returns the path of the file relative to the directory if it is inside the directory
+func relativeTo(dir, fileName string) string {
+	rel, err := filepath.Rel(dir, fileName)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return fileName
+	}
+	return filepath.ToSlash(rel)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		logrus.WithError(err).Warn("failed to marshal JSON response")
+		http.Error(w, "failed to marshal JSON", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
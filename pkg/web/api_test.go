@@ -0,0 +1,194 @@
+package web_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/gitstore"
+	"github.com/jenkins-x/jx-test-collector/pkg/search"
+	"github.com/jenkins-x/jx-test-collector/pkg/web"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeTargets []web.TargetStatus
+
+func (f fakeTargets) Targets() []*web.TargetStatus {
+	var answer []*web.TargetStatus
+	for i := range f {
+		t := f[i]
+		answer = append(answer, &t)
+	}
+	return answer
+}
+
+func TestAPI(t *testing.T) {
+	tmpDir := createWorkDir(t)
+	podPath := "jx/tekton-pipelines/myorg/myrepo/PR-1/myorg-myrepo-pr-1-2-pod"
+
+	o := &web.Options{
+		Dir:          tmpDir,
+		LogPath:      "logs",
+		ResourcePath: "resources",
+		Targets: fakeTargets{
+			{
+				Namespace: "jx",
+				Pod:       "myorg-myrepo-pr-1-2-pod",
+				Container: "step-build",
+				Path:      podPath,
+				Tailing:   true,
+				Lines:     1,
+				Bytes:     9,
+				LogFile:   filepath.Join(tmpDir, "logs", podPath, "step-build.log"),
+			},
+			{
+				Namespace: "other",
+				Pod:       "myapp",
+				Container: "myapp",
+				Path:      "other/myapp",
+				LogFile:   filepath.Join(tmpDir, "logs", "other", "myapp", "myapp.log"),
+			},
+		},
+		ResourceFile: func(group, version, resource, namespace, name string) (string, error) {
+			if resource == "invalid" {
+				return "", errors.Errorf("invalid resource %s", resource)
+			}
+			return filepath.Join(tmpDir, "resources", group, version, resource, namespace, name+".yaml"), nil
+		},
+	}
+	started := time.Now().Add(-time.Minute)
+	o.History.Add(started, &gitstore.SyncResult{Output: "sync completed", Commit: "abc123", FilesAdded: 2, Bytes: 42}, nil)
+	o.History.Add(started.Add(time.Second), nil, errors.New("failed to push"))
+
+	server := httptest.NewServer(o.Handler())
+	defer server.Close()
+
+	var targets []web.TargetStatus
+	getJSON(t, server.URL+web.APITargetsPath+"?namespace=jx", http.StatusOK, &targets)
+	require.Len(t, targets, 1, "targets in namespace jx")
+	assert.Equal(t, "step-build", targets[0].Container, "container")
+	assert.Equal(t, "logs/"+podPath+"/step-build.log", targets[0].LogFile, "relative log file")
+	assert.Equal(t, int64(9), targets[0].FileBytes, "log file size")
+	assert.True(t, targets[0].Tailing, "tailing")
+
+	getJSON(t, server.URL+web.APITargetsPath, http.StatusOK, &targets)
+	assert.Len(t, targets, 2, "all targets")
+
+	resource := map[string]interface{}{}
+	getJSON(t, server.URL+web.APIResourcesPath+"jenkins.io/v1/pipelineactivities/jx/myorg-myrepo-pr-1-2", http.StatusOK, &resource)
+	assert.Equal(t, "PipelineActivity", resource["kind"], "resource kind")
+
+	getJSON(t, server.URL+web.APIResourcesPath+"core/v1/pods/jx/does-not-exist", http.StatusNotFound, &resource)
+	assert.Equal(t, "resource not found", resource["error"], "missing resource error")
+	getJSON(t, server.URL+web.APIResourcesPath+"core/v1/invalid/jx/mypod", http.StatusBadRequest, &resource)
+	getJSON(t, server.URL+web.APIResourcesPath+"core/v1", http.StatusBadRequest, &resource)
+
+	var syncs []web.SyncRecord
+	getJSON(t, server.URL+web.APISyncsPath, http.StatusOK, &syncs)
+	require.Len(t, syncs, 2, "syncs")
+	assert.Equal(t, "failed to push", syncs[0].Error, "most recent sync error")
+	assert.Equal(t, "sync completed", syncs[1].Output, "oldest sync output")
+	assert.Equal(t, "abc123", syncs[1].Commit, "oldest sync commit")
+	assert.Equal(t, 2, syncs[1].FilesAdded, "oldest sync files added")
+	assert.Equal(t, int64(42), syncs[1].Bytes, "oldest sync bytes")
+}
+
+func TestSync(t *testing.T) {
+	o := &web.Options{}
+	o.Sync = func() (*web.SyncRecord, error) {
+		return o.History.Add(time.Now(), &gitstore.SyncResult{Output: "sync completed", Commit: "abc123", FilesChanged: 1, Bytes: 10}, nil), nil
+	}
+	server := httptest.NewServer(o.Handler())
+	defer server.Close()
+
+	status := &web.SyncStatus{}
+	getJSON(t, server.URL+web.SyncStatusPath, http.StatusOK, status)
+	assert.Nil(t, status.NextSync, "next sync before the sync loop starts")
+	assert.Empty(t, status.Syncs, "syncs before any sync")
+
+	record := &web.SyncRecord{}
+	postJSON(t, server.URL+web.SyncPath, http.StatusOK, record)
+	assert.Equal(t, "abc123", record.Commit, "commit")
+	assert.Equal(t, 1, record.FilesChanged, "files changed")
+	assert.Equal(t, int64(10), record.Bytes, "bytes")
+
+	next := time.Now().Add(5 * time.Minute).UTC()
+	o.History.SetNextSync(next)
+	postJSON(t, server.URL+web.SyncPath, http.StatusOK, record)
+
+	getJSON(t, server.URL+web.SyncStatusPath+"?limit=1", http.StatusOK, status)
+	require.NotNil(t, status.NextSync, "next sync")
+	assert.True(t, next.Equal(*status.NextSync), "next sync time")
+	assert.Len(t, status.Syncs, 1, "limited syncs")
+
+	getJSON(t, server.URL+web.SyncStatusPath, http.StatusOK, status)
+	assert.Len(t, status.Syncs, 2, "all syncs")
+
+	o.Sync = func() (*web.SyncRecord, error) {
+		err := errors.New("failed to push")
+		return o.History.Add(time.Now(), nil, err), err
+	}
+	postJSON(t, server.URL+web.SyncPath, http.StatusInternalServerError, record)
+	assert.Equal(t, "failed to push", record.Error, "sync error")
+	getJSON(t, server.URL+web.SyncStatusPath+"?limit=-1", http.StatusBadRequest, &map[string]string{})
+}
+
+func TestSyncHistorySize(t *testing.T) {
+	h := &web.SyncHistory{Size: 2}
+	for _, output := range []string{"first", "second", "third"} {
+		h.Add(time.Now(), &gitstore.SyncResult{Output: output}, nil)
+	}
+	records := h.Records()
+	require.Len(t, records, 2, "records")
+	assert.Equal(t, "third", records[0].Output, "most recent")
+	assert.Equal(t, "second", records[1].Output, "oldest")
+}
+
+func getJSON(t *testing.T, u string, expectedStatus int, v interface{}) {
+	body := get(t, u, expectedStatus)
+	err := json.Unmarshal([]byte(body), v)
+	require.NoError(t, err, "failed to parse JSON from %s: %s", u, body)
+}
+
+func postJSON(t *testing.T, u string, expectedStatus int, v interface{}) {
+	resp, err := http.Post(u, "application/json", nil)
+	require.NoError(t, err, "failed to post %s", u)
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err, "failed to read %s", u)
+	assert.Equal(t, expectedStatus, resp.StatusCode, "status of %s", u)
+	err = json.Unmarshal(data, v)
+	require.NoError(t, err, "failed to parse JSON from %s: %s", u, string(data))
+}
+
+func TestSearchAPI(t *testing.T) {
+	index := &search.Index{}
+	index.Add(&search.Context{Namespace: "jx", Pod: "mypod", Container: "step-test", PipelineRun: "myrun", LogFile: "logs/jx/mypod/step-test.log"}, 7, "--- FAIL: TestFoo", time.Now())
+	index.Add(&search.Context{Namespace: "other", Pod: "myapp", Container: "myapp", LogFile: "logs/other/myapp/myapp.log"}, 1, "FAIL", time.Now())
+
+	o := &web.Options{Search: index}
+	server := httptest.NewServer(o.Handler())
+	defer server.Close()
+
+	results := &web.SearchResponse{}
+	getJSON(t, server.URL+web.APISearchPath+"?q=fail&namespace=jx", http.StatusOK, results)
+	require.Len(t, results.Results, 1, "results")
+	r := results.Results[0]
+	assert.Equal(t, "step-test", r.Container, "container")
+	assert.Equal(t, "myrun", r.PipelineRun, "pipeline run")
+	assert.Equal(t, 7, r.Line, "line")
+	assert.Equal(t, web.UIFilePath+"?path=logs%2Fjx%2Fmypod%2Fstep-test.log", r.FileURL, "file URL")
+	assert.Equal(t, "/logs/jx/mypod/step-test", r.LogURL, "log URL")
+
+	getJSON(t, server.URL+web.APISearchPath+"?q=fail", http.StatusOK, results)
+	assert.Len(t, results.Results, 2, "results in all namespaces")
+
+	getJSON(t, server.URL+web.APISearchPath+"?q=", http.StatusBadRequest, &map[string]string{})
+	getJSON(t, server.URL+web.APISearchPath+"?q=fail&limit=x", http.StatusBadRequest, &map[string]string{})
+}
@@ -0,0 +1,396 @@
+package web
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Permission the permission required to use an endpoint
+type Permission string
+
+const (
+	// PermissionRead allows reading logs, resources and the status of the collector
+	PermissionRead Permission = "read"
+
+	// PermissionTrigger allows triggering a sync. It implies PermissionRead
+	PermissionTrigger Permission = "trigger"
+)
+
+const (
+	// AuthModeNone disables authentication so that anyone who can reach the service can use it
+	AuthModeNone = "none"
+
+	// AuthModeToken requires a bearer token matching the read or trigger token in a Secret
+	AuthModeToken = "token"
+
+	// AuthModeKubernetes authenticates bearer tokens using a TokenReview and authorizes the user
+	// using a SubjectAccessReview
+	AuthModeKubernetes = "kubernetes"
+
+	// AuthModeProxy trusts the user name header set by an authenticating proxy such as oauth2-proxy
+	AuthModeProxy = "proxy"
+
+	// ReadTokenKey the key in the auth Secret of the token allowed to read
+	ReadTokenKey = "read-token"
+
+	// TriggerTokenKey the key in the auth Secret of the token allowed to read and trigger syncs
+	TriggerTokenKey = "trigger-token"
+)
+
+var (
+	// ErrUnauthenticated the request has no valid credentials
+	ErrUnauthenticated = errors.New("unauthenticated")
+
+	// ErrForbidden the credentials of the request do not have the required permission
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Authorizer checks that requests have a permission
+type Authorizer interface {
+	// Authorize returns nil if the request has the permission, otherwise an error caused by
+	// ErrUnauthenticated or ErrForbidden
+	Authorize(r *http.Request, permission Permission) error
+}
+
+// AuthOptions the configuration of the authentication and authorization of the endpoints.
+//
+// The health, ready and metrics endpoints are never authenticated so they can be used by probes and scrapers
+type AuthOptions struct {
+	// Mode one of 'none', 'token', 'kubernetes' or 'proxy'. Defaults to 'none'
+	Mode string `env:"AUTH_MODE"`
+
+	// Namespace the namespace of the token Secret and of the resource checked by SubjectAccessReviews
+	Namespace string `env:"AUTH_NAMESPACE,default=jx"`
+
+	// SecretName the name of the Secret containing the read-token and trigger-token in token mode
+	SecretName string `env:"AUTH_SECRET,default=jx-test-collector-auth"`
+
+	// Group the API group of the resource checked by SubjectAccessReviews in kubernetes mode
+	Group string `env:"AUTH_RESOURCE_GROUP"`
+
+	// Resource the resource checked by SubjectAccessReviews in kubernetes mode
+	Resource string `env:"AUTH_RESOURCE,default=services"`
+
+	// Subresource the subresource checked by SubjectAccessReviews in kubernetes mode
+	Subresource string `env:"AUTH_SUBRESOURCE,default=proxy"`
+
+	// ResourceName the name of the resource checked by SubjectAccessReviews in kubernetes mode
+	ResourceName string `env:"AUTH_RESOURCE_NAME,default=jx-test-collector"`
+
+	// ReadVerb the verb checked by SubjectAccessReviews in kubernetes mode to read
+	ReadVerb string `env:"AUTH_READ_VERB,default=get"`
+
+	// TriggerVerb the verb checked by SubjectAccessReviews in kubernetes mode to trigger syncs
+	TriggerVerb string `env:"AUTH_TRIGGER_VERB,default=create"`
+
+	// CacheDuration how long the reviews in kubernetes mode and the tokens loaded from the Secret in token mode
+	// are cached so that rotated tokens are used without a restart
+	CacheDuration time.Duration `env:"AUTH_CACHE_DURATION,default=1m"`
+
+	// ProxyHeader the header containing the user name set by the authenticating proxy in proxy mode
+	ProxyHeader string `env:"AUTH_PROXY_HEADER,default=X-Forwarded-User"`
+
+	// ReadUsers the users allowed to read in proxy mode. If empty any user authenticated by the proxy can read
+	ReadUsers []string `env:"AUTH_READ_USERS"`
+
+	// TriggerUsers the users allowed to trigger syncs in proxy mode. If empty any user who can read can trigger syncs
+	TriggerUsers []string `env:"AUTH_TRIGGER_USERS"`
+}
+
+// NewAuthorizer creates the authorizer for the mode returning nil if authentication is disabled
+func (o *AuthOptions) NewAuthorizer(kubeClient kubernetes.Interface) (Authorizer, error) {
+	switch o.Mode {
+	case "", AuthModeNone:
+		return nil, nil
+	case AuthModeToken:
+		return o.newTokenAuthorizer(kubeClient)
+	case AuthModeKubernetes:
+		return &kubeAuthorizer{
+			AuthOptions: o,
+			kubeClient:  kubeClient,
+			cache:       map[string]*review{},
+		}, nil
+	case AuthModeProxy:
+		if o.ProxyHeader == "" {
+			return nil, errors.Errorf("no proxy header configured")
+		}
+		return &proxyAuthorizer{
+			header:       o.ProxyHeader,
+			readUsers:    userSet(o.ReadUsers),
+			triggerUsers: userSet(o.TriggerUsers),
+		}, nil
+	default:
+		return nil, errors.Errorf("unknown auth mode %s", o.Mode)
+	}
+}
+
+// authorize wraps the handler so that requests must have the permission. Requests needing the trigger
+// permission must use POST so that they cannot be triggered by links or prefetching
+func (o *Options) authorize(permission Permission, handler http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if permission == PermissionTrigger && r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if o.Authorizer != nil {
+			err := o.Authorizer.Authorize(r, permission)
+			if err != nil {
+				writeAuthError(w, r, err)
+				return
+			}
+		}
+		handler(w, r)
+	})
+}
+
+func writeAuthError(w http.ResponseWriter, r *http.Request, err error) {
+	switch errors.Cause(err) {
+	case ErrUnauthenticated:
+		w.Header().Set("WWW-Authenticate", `Bearer realm="jx-test-collector"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case ErrForbidden:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	default:
+		logrus.WithError(err).Warnf("failed to authorize request %s", r.URL.Path)
+		http.Error(w, "failed to authorize request", http.StatusInternalServerError)
+	}
+}
+
+// bearerToken returns the bearer token of the Authorization header
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// tokenAuthorizer compares bearer tokens with the tokens loaded from a Secret which is loaded again
+// once the cache duration has passed so that the tokens can be rotated
+type tokenAuthorizer struct {
+	*AuthOptions
+	kubeClient kubernetes.Interface
+
+	lock         sync.Mutex
+	readToken    string
+	triggerToken string
+	expires      time.Time
+}
+
+func (o *AuthOptions) newTokenAuthorizer(kubeClient kubernetes.Interface) (*tokenAuthorizer, error) {
+	if kubeClient == nil {
+		return nil, errors.Errorf("no kubernetes client to load the Secret %s", o.SecretName)
+	}
+	answer := &tokenAuthorizer{
+		AuthOptions: o,
+		kubeClient:  kubeClient,
+	}
+	readToken, triggerToken, err := answer.load()
+	if err != nil {
+		return nil, err
+	}
+	if readToken == "" && triggerToken == "" {
+		return nil, errors.Errorf("secret %s in namespace %s has no %s or %s entry", o.SecretName, o.Namespace, ReadTokenKey, TriggerTokenKey)
+	}
+	answer.readToken = readToken
+	answer.triggerToken = triggerToken
+	answer.expires = time.Now().Add(o.CacheDuration)
+	return answer, nil
+}
+
+// load loads the tokens from the Secret
+func (a *tokenAuthorizer) load() (string, string, error) {
+	secret, err := a.kubeClient.CoreV1().Secrets(a.Namespace).Get(context.Background(), a.SecretName, metav1.GetOptions{})
+	if err != nil {
+		return "", "", errors.Wrapf(err, "failed to load Secret %s in namespace %s", a.SecretName, a.Namespace)
+	}
+	return strings.TrimSpace(string(secret.Data[ReadTokenKey])), strings.TrimSpace(string(secret.Data[TriggerTokenKey])), nil
+}
+
+// tokens returns the read and trigger tokens loading the Secret again if the cache has expired.
+// If the Secret has been deleted no tokens are allowed but other failures keep the previous tokens
+func (a *tokenAuthorizer) tokens() (string, string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	now := time.Now()
+	if now.Before(a.expires) {
+		return a.readToken, a.triggerToken
+	}
+	readToken, triggerToken, err := a.load()
+	if err != nil && !apierrors.IsNotFound(errors.Cause(err)) {
+		logrus.WithError(err).Warn("failed to reload the auth tokens so using the previous tokens")
+		return a.readToken, a.triggerToken
+	}
+	if readToken == "" && triggerToken == "" {
+		logrus.Warnf("secret %s in namespace %s has no tokens so all requests are denied", a.SecretName, a.Namespace)
+	}
+	a.readToken = readToken
+	a.triggerToken = triggerToken
+	a.expires = now.Add(a.CacheDuration)
+	return readToken, triggerToken
+}
+
+// Authorize allows the trigger token any permission and the read token to read
+func (a *tokenAuthorizer) Authorize(r *http.Request, permission Permission) error {
+	token := bearerToken(r)
+	if token == "" {
+		return errors.Wrap(ErrUnauthenticated, "no bearer token")
+	}
+	readToken, triggerToken := a.tokens()
+	if tokenEqual(token, triggerToken) {
+		return nil
+	}
+	if tokenEqual(token, readToken) {
+		if permission == PermissionRead {
+			return nil
+		}
+		return errors.Wrapf(ErrForbidden, "the token does not have the %s permission", permission)
+	}
+	return errors.Wrap(ErrUnauthenticated, "invalid bearer token")
+}
+
+func tokenEqual(token, expected string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// review a cached review of a token and permission
+type review struct {
+	err     error
+	expires time.Time
+}
+
+// kubeAuthorizer authenticates bearer tokens using TokenReviews and authorizes the users with SubjectAccessReviews
+type kubeAuthorizer struct {
+	*AuthOptions
+	kubeClient kubernetes.Interface
+
+	lock  sync.Mutex
+	cache map[string]*review
+}
+
+// Authorize reviews the token and permission caching the result for the cache duration
+func (a *kubeAuthorizer) Authorize(r *http.Request, permission Permission) error {
+	token := bearerToken(r)
+	if token == "" {
+		return errors.Wrap(ErrUnauthenticated, "no bearer token")
+	}
+	key := string(permission) + ":" + token
+	now := time.Now()
+
+	a.lock.Lock()
+	cached := a.cache[key]
+	a.lock.Unlock()
+	if cached != nil && now.Before(cached.expires) {
+		return cached.err
+	}
+
+	err := a.review(r.Context(), token, permission)
+	if err != nil && errors.Cause(err) != ErrUnauthenticated && errors.Cause(err) != ErrForbidden {
+		// lets not cache failures to talk to the API server
+		return err
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for k, v := range a.cache {
+		if !now.Before(v.expires) {
+			delete(a.cache, k)
+		}
+	}
+	a.cache[key] = &review{err: err, expires: now.Add(a.CacheDuration)}
+	return err
+}
+
+func (a *kubeAuthorizer) review(ctx context.Context, token string, permission Permission) error {
+	tr, err := a.kubeClient.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token: token,
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to create TokenReview")
+	}
+	if !tr.Status.Authenticated {
+		return errors.Wrap(ErrUnauthenticated, "invalid bearer token")
+	}
+	user := tr.Status.User
+
+	verb := a.ReadVerb
+	if permission == PermissionTrigger {
+		verb = a.TriggerVerb
+	}
+	extra := map[string]authorizationv1.ExtraValue{}
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	sar, err := a.kubeClient.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			UID:    user.UID,
+			Groups: user.Groups,
+			Extra:  extra,
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace:   a.Namespace,
+				Verb:        verb,
+				Group:       a.Group,
+				Resource:    a.Resource,
+				Subresource: a.Subresource,
+				Name:        a.ResourceName,
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to create SubjectAccessReview")
+	}
+	if !sar.Status.Allowed {
+		return errors.Wrapf(ErrForbidden, "user %s cannot %s %s", user.Username, verb, a.Resource)
+	}
+	return nil
+}
+
+// proxyAuthorizer trusts the user name header set by an authenticating proxy
+type proxyAuthorizer struct {
+	header       string
+	readUsers    map[string]bool
+	triggerUsers map[string]bool
+}
+
+// Authorize allows the trigger users any permission and the read users to read. If there are no read users
+// any user authenticated by the proxy can read and if there are no trigger users any user who can read can trigger
+func (a *proxyAuthorizer) Authorize(r *http.Request, permission Permission) error {
+	user := strings.TrimSpace(r.Header.Get(a.header))
+	if user == "" {
+		return errors.Wrapf(ErrUnauthenticated, "no %s header", a.header)
+	}
+	canRead := len(a.readUsers) == 0 || a.readUsers[user] || a.triggerUsers[user]
+	canTrigger := a.triggerUsers[user] || (len(a.triggerUsers) == 0 && canRead)
+	if canTrigger || (permission == PermissionRead && canRead) {
+		return nil
+	}
+	return errors.Wrapf(ErrForbidden, "user %s does not have the %s permission", user, permission)
+}
+
+func userSet(users []string) map[string]bool {
+	answer := map[string]bool{}
+	for _, u := range users {
+		u = strings.TrimSpace(u)
+		if u != "" {
+			answer[u] = true
+		}
+	}
+	return answer
+}
@@ -0,0 +1,230 @@
+package web_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/gitstore"
+	"github.com/jenkins-x/jx-test-collector/pkg/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestTokenAuth(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "jx-test-collector-auth",
+			Namespace: "jx",
+		},
+		Data: map[string][]byte{
+			web.ReadTokenKey:    []byte("reader\n"),
+			web.TriggerTokenKey: []byte("trigger"),
+		},
+	})
+	o := newAuthOptions(t, web.AuthOptions{
+		Mode:       web.AuthModeToken,
+		Namespace:  "jx",
+		SecretName: "jx-test-collector-auth",
+	}, kubeClient)
+	server := httptest.NewServer(o.Handler())
+	defer server.Close()
+
+	for _, tc := range []struct {
+		path, token string
+		status      int
+	}{
+		{web.HealthPath, "", http.StatusNoContent},
+		{web.SyncStatusPath, "", http.StatusUnauthorized},
+		{web.SyncStatusPath, "wrong", http.StatusUnauthorized},
+		{web.SyncStatusPath, "reader", http.StatusOK},
+		{web.SyncStatusPath, "trigger", http.StatusOK},
+		{web.SyncPath, "reader", http.StatusForbidden},
+		{web.SyncPath, "trigger", http.StatusOK},
+	} {
+		assertAuthStatus(t, requestMethod(tc.path), server.URL+tc.path, "Authorization", "Bearer "+tc.token, tc.status)
+	}
+
+	// syncs cannot be triggered with GET
+	assertAuthStatus(t, http.MethodGet, server.URL+web.SyncPath, "Authorization", "Bearer trigger", http.StatusMethodNotAllowed)
+
+	_, err := (&web.AuthOptions{Mode: web.AuthModeToken, Namespace: "jx", SecretName: "missing"}).NewAuthorizer(kubeClient)
+	assert.Error(t, err, "should fail if the Secret does not exist")
+}
+
+func TestTokenAuthRotation(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "jx-test-collector-auth",
+			Namespace: "jx",
+		},
+		Data: map[string][]byte{
+			web.ReadTokenKey: []byte("old"),
+		},
+	}
+	kubeClient := fake.NewSimpleClientset(secret)
+	o := newAuthOptions(t, web.AuthOptions{
+		Mode:          web.AuthModeToken,
+		Namespace:     "jx",
+		SecretName:    "jx-test-collector-auth",
+		CacheDuration: time.Hour,
+	}, kubeClient)
+	server := httptest.NewServer(o.Handler())
+	defer server.Close()
+
+	u := server.URL + web.SyncStatusPath
+	assertAuthStatus(t, http.MethodGet, u, "Authorization", "Bearer old", http.StatusOK)
+
+	secret.Data[web.ReadTokenKey] = []byte("new")
+	_, err := kubeClient.CoreV1().Secrets("jx").Update(context.Background(), secret, metav1.UpdateOptions{})
+	require.NoError(t, err, "failed to update Secret")
+
+	// the tokens are cached
+	assertAuthStatus(t, http.MethodGet, u, "Authorization", "Bearer old", http.StatusOK)
+	assertAuthStatus(t, http.MethodGet, u, "Authorization", "Bearer new", http.StatusUnauthorized)
+
+	// without a cache the rotated token is used
+	o = newAuthOptions(t, web.AuthOptions{
+		Mode:       web.AuthModeToken,
+		Namespace:  "jx",
+		SecretName: "jx-test-collector-auth",
+	}, kubeClient)
+	server2 := httptest.NewServer(o.Handler())
+	defer server2.Close()
+
+	u = server2.URL + web.SyncStatusPath
+	assertAuthStatus(t, http.MethodGet, u, "Authorization", "Bearer new", http.StatusOK)
+
+	secret.Data[web.ReadTokenKey] = []byte("newer")
+	_, err = kubeClient.CoreV1().Secrets("jx").Update(context.Background(), secret, metav1.UpdateOptions{})
+	require.NoError(t, err, "failed to update Secret")
+
+	assertAuthStatus(t, http.MethodGet, u, "Authorization", "Bearer new", http.StatusUnauthorized)
+	assertAuthStatus(t, http.MethodGet, u, "Authorization", "Bearer newer", http.StatusOK)
+
+	// deleting the Secret revokes the tokens
+	err = kubeClient.CoreV1().Secrets("jx").Delete(context.Background(), secret.Name, metav1.DeleteOptions{})
+	require.NoError(t, err, "failed to delete Secret")
+	assertAuthStatus(t, http.MethodGet, u, "Authorization", "Bearer newer", http.StatusUnauthorized)
+}
+
+func TestKubernetesAuth(t *testing.T) {
+	kubeClient := fake.NewSimpleClientset()
+	reviews := 0
+	kubeClient.PrependReactor("create", "tokenreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		reviews++
+		tr := action.(k8stesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		if tr.Spec.Token == "reader" || tr.Spec.Token == "admin" {
+			tr.Status.Authenticated = true
+			tr.Status.User.Username = tr.Spec.Token
+		}
+		return true, tr, nil
+	})
+	kubeClient.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		sar := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		attrs := sar.Spec.ResourceAttributes
+		assert.Equal(t, "services", attrs.Resource, "resource")
+		assert.Equal(t, "proxy", attrs.Subresource, "subresource")
+		assert.Equal(t, "jx-test-collector", attrs.Name, "resource name")
+		sar.Status.Allowed = sar.Spec.User == "admin" || attrs.Verb == "get"
+		return true, sar, nil
+	})
+
+	o := newAuthOptions(t, web.AuthOptions{
+		Mode:          web.AuthModeKubernetes,
+		Namespace:     "jx",
+		Resource:      "services",
+		Subresource:   "proxy",
+		ResourceName:  "jx-test-collector",
+		ReadVerb:      "get",
+		TriggerVerb:   "create",
+		CacheDuration: time.Minute,
+	}, kubeClient)
+	server := httptest.NewServer(o.Handler())
+	defer server.Close()
+
+	for _, tc := range []struct {
+		path, token string
+		status      int
+	}{
+		{web.SyncStatusPath, "", http.StatusUnauthorized},
+		{web.SyncStatusPath, "unknown", http.StatusUnauthorized},
+		{web.SyncStatusPath, "reader", http.StatusOK},
+		{web.SyncPath, "reader", http.StatusForbidden},
+		{web.SyncPath, "admin", http.StatusOK},
+	} {
+		assertAuthStatus(t, requestMethod(tc.path), server.URL+tc.path, "Authorization", "Bearer "+tc.token, tc.status)
+	}
+
+	before := reviews
+	assertAuthStatus(t, http.MethodGet, server.URL+web.SyncStatusPath, "Authorization", "Bearer reader", http.StatusOK)
+	assert.Equal(t, before, reviews, "should use the cached review")
+}
+
+func TestProxyAuth(t *testing.T) {
+	o := newAuthOptions(t, web.AuthOptions{
+		Mode:         web.AuthModeProxy,
+		ProxyHeader:  "X-Forwarded-User",
+		ReadUsers:    []string{"alice", "bob"},
+		TriggerUsers: []string{"carol"},
+	}, nil)
+	server := httptest.NewServer(o.Handler())
+	defer server.Close()
+
+	for _, tc := range []struct {
+		path, user string
+		status     int
+	}{
+		{web.ReadyPath, "", http.StatusNoContent},
+		{web.SyncStatusPath, "", http.StatusUnauthorized},
+		{web.SyncStatusPath, "mallory", http.StatusForbidden},
+		{web.SyncStatusPath, "alice", http.StatusOK},
+		{web.SyncStatusPath, "carol", http.StatusOK},
+		{web.SyncPath, "bob", http.StatusForbidden},
+		{web.SyncPath, "carol", http.StatusOK},
+	} {
+		assertAuthStatus(t, requestMethod(tc.path), server.URL+tc.path, "X-Forwarded-User", tc.user, tc.status)
+	}
+}
+
+func newAuthOptions(t *testing.T, auth web.AuthOptions, kubeClient kubernetes.Interface) *web.Options {
+	o := &web.Options{Auth: auth}
+	var err error
+	o.Authorizer, err = o.Auth.NewAuthorizer(kubeClient)
+	require.NoError(t, err, "failed to create authorizer")
+	require.NotNil(t, o.Authorizer, "authorizer")
+	o.Sync = func() (*web.SyncRecord, error) {
+		return o.History.Add(time.Now(), &gitstore.SyncResult{Output: "sync completed"}, nil), nil
+	}
+	return o
+}
+
+// requestMethod returns the method to request the path with as syncs are triggered with POST
+func requestMethod(path string) string {
+	if path == web.SyncPath {
+		return http.MethodPost
+	}
+	return http.MethodGet
+}
+
+func assertAuthStatus(t *testing.T, method, u, header, value string, expectedStatus int) {
+	req, err := http.NewRequest(method, u, nil)
+	require.NoError(t, err, "failed to create request %s", u)
+	if value != "" && value != "Bearer " {
+		req.Header.Set(header, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err, "failed to get %s", u)
+	resp.Body.Close()
+	assert.Equal(t, expectedStatus, resp.StatusCode, "status of %s with %s %q", u, header, value)
+}
@@ -0,0 +1,461 @@
+package web
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/logfiles"
+	"github.com/sirupsen/logrus"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// StatusRunning the status of a pipeline run or pod which has not completed
+	StatusRunning = "Running"
+
+	// StatusSucceeded the status of a pipeline run or pod which completed successfully
+	StatusSucceeded = "Succeeded"
+
+	// StatusFailed the status of a pipeline run or pod which failed
+	StatusFailed = "Failed"
+
+	// StatusUnknown the status if there is no metadata
+	StatusUnknown = "Unknown"
+)
+
+// Catalog the namespaces, pipeline runs and pods found in the files written by the collector
+type Catalog struct {
+	Namespaces []*NamespaceSummary
+	Runs       []*RunSummary
+}
+
+// NamespaceSummary the pods and pipeline runs in a namespace
+type NamespaceSummary struct {
+	Name string
+	Pods []*PodSummary
+	Runs []*RunSummary
+}
+
+// RunSummary a pipeline run found from the PipelineActivity resources and the labels of its pods
+type RunSummary struct {
+	Namespace  string
+	Owner      string
+	Repository string
+	Branch     string
+	Build      string
+	Status     string
+	Started    string
+
+	// ResourcePath the path of the PipelineActivity YAML relative to the work directory
+	ResourcePath string
+	Pods         []*PodSummary
+}
+
+// PodSummary a pod directory containing logs
+type PodSummary struct {
+	Namespace string
+	Name      string
+	Phase     string
+	Status    string
+	Labels    map[string]string
+
+	// Path the path of the pod directory relative to the work directory
+	Path string
+
+	// EventsPath the path of the events log relative to the work directory if it exists
+	EventsPath string
+
+	// ResourcePath the path of the pod YAML relative to the work directory if it exists
+	ResourcePath string
+
+	Containers []*ContainerSummary
+}
+
+// ContainerSummary a container log
+type ContainerSummary struct {
+	Name           string
+	Terminated     bool
+	ExitCode       int32
+	Reason         string
+	TruncatedBytes int64
+
+	// LogPath the path of the log file relative to the work directory
+	LogPath string
+}
+
+// podMetadata the fields of the metadata.json file written by the tailer used by the UI
+type podMetadata struct {
+	Namespace  string            `json:"namespace"`
+	Name       string            `json:"name"`
+	Labels     map[string]string `json:"labels"`
+	Phase      string            `json:"phase"`
+	Containers []struct {
+		Name           string `json:"name"`
+		Terminated     bool   `json:"terminated"`
+		ExitCode       int32  `json:"exitCode"`
+		Reason         string `json:"reason"`
+		TruncatedBytes int64  `json:"truncatedBytes"`
+	} `json:"containers"`
+}
+
+// resourceHeader the fields of a resource YAML file used by the UI
+type resourceHeader struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		GitOwner         string `json:"gitOwner"`
+		GitRepository    string `json:"gitRepository"`
+		GitBranch        string `json:"gitBranch"`
+		Build            string `json:"build"`
+		Status           string `json:"status"`
+		StartedTimestamp string `json:"startedTimestamp"`
+	} `json:"spec"`
+}
+
+// resourceCache caches the headers of resource files so that they are only parsed when they change
+type resourceCache struct {
+	lock    sync.Mutex
+	entries map[string]*resourceEntry
+}
+
+type resourceEntry struct {
+	modTime time.Time
+	header  *resourceHeader
+}
+
+// catalogCache caches the catalog so that the directories are not scanned on every request
+type catalogCache struct {
+	lock    sync.Mutex
+	loaded  time.Time
+	catalog *Catalog
+}
+
+// CachedCatalog returns the catalog if it was loaded within the CatalogCacheDuration otherwise it is loaded again.
+// Concurrent requests wait for and share the same load
+func (o *Options) CachedCatalog() (*Catalog, error) {
+	if o.CatalogCacheDuration <= 0 {
+		return o.LoadCatalog()
+	}
+	c := &o.catalog
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	if c.catalog != nil && now.Sub(c.loaded) < o.CatalogCacheDuration {
+		return c.catalog, nil
+	}
+	catalog, err := o.LoadCatalog()
+	if err != nil {
+		return nil, err
+	}
+	c.catalog = catalog
+	c.loaded = now
+	return catalog, nil
+}
+
+// LoadCatalog scans the log and resource directories to find the pods and pipeline runs
+func (o *Options) LoadCatalog() (*Catalog, error) {
+	pods, err := o.loadPods()
+	if err != nil {
+		return nil, err
+	}
+	resources := o.loadResources()
+
+	podResources := map[string]string{}
+	runs := map[string]*RunSummary{}
+	for path, r := range resources {
+		switch r.Kind {
+		case "Pod":
+			podResources[r.Metadata.Namespace+"/"+r.Metadata.Name] = path
+		case "PipelineActivity":
+			run := &RunSummary{
+				Namespace:    r.Metadata.Namespace,
+				Owner:        r.Spec.GitOwner,
+				Repository:   r.Spec.GitRepository,
+				Branch:       r.Spec.GitBranch,
+				Build:        r.Spec.Build,
+				Status:       r.Spec.Status,
+				Started:      r.Spec.StartedTimestamp,
+				ResourcePath: path,
+			}
+			runs[run.key()] = run
+		}
+	}
+
+	namespaces := map[string]*NamespaceSummary{}
+	namespace := func(name string) *NamespaceSummary {
+		ns := namespaces[name]
+		if ns == nil {
+			ns = &NamespaceSummary{Name: name}
+			namespaces[name] = ns
+		}
+		return ns
+	}
+	for _, pod := range pods {
+		pod.ResourcePath = podResources[pod.Namespace+"/"+pod.Name]
+		ns := namespace(pod.Namespace)
+		ns.Pods = append(ns.Pods, pod)
+
+		labels := pod.Labels
+		if labels["owner"] == "" || labels["repository"] == "" {
+			continue
+		}
+		run := &RunSummary{
+			Namespace:  pod.Namespace,
+			Owner:      labels["owner"],
+			Repository: labels["repository"],
+			Branch:     labels["branch"],
+			Build:      labels["build"],
+		}
+		if runs[run.key()] == nil {
+			runs[run.key()] = run
+		}
+		runs[run.key()].Pods = append(runs[run.key()].Pods, pod)
+	}
+
+	catalog := &Catalog{}
+	for _, run := range runs {
+		if run.Status == "" {
+			run.Status = podsStatus(run.Pods)
+		}
+		catalog.Runs = append(catalog.Runs, run)
+		ns := namespace(run.Namespace)
+		ns.Runs = append(ns.Runs, run)
+	}
+	sort.Slice(catalog.Runs, func(i, j int) bool {
+		return catalog.Runs[i].key() < catalog.Runs[j].key()
+	})
+	for _, ns := range namespaces {
+		sort.Slice(ns.Runs, func(i, j int) bool {
+			return ns.Runs[i].key() < ns.Runs[j].key()
+		})
+		catalog.Namespaces = append(catalog.Namespaces, ns)
+	}
+	sort.Slice(catalog.Namespaces, func(i, j int) bool {
+		return catalog.Namespaces[i].Name < catalog.Namespaces[j].Name
+	})
+	return catalog, nil
+}
+
+// key returns the sort and lookup key for the run, padding the build number so runs sort numerically
+func (r *RunSummary) key() string {
+	build := r.Build
+	for len(build) < 10 {
+		build = "0" + build
+	}
+	return strings.Join([]string{r.Namespace, r.Owner, r.Repository, r.Branch, build}, "/")
+}
+
+// loadPods finds the pod directories in the log directory which contain logs or metadata
+func (o *Options) loadPods() ([]*PodSummary, error) {
+	logDir := filepath.Join(o.Dir, o.LogPath)
+	var pods []*PodSummary
+	err := filepath.Walk(logDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		pod, err := o.loadPod(path)
+		if err != nil {
+			logrus.WithError(err).Warnf("failed to load pod from %s", path)
+			return nil
+		}
+		if pod != nil {
+			pods = append(pods, pod)
+		}
+		return nil
+	})
+	sort.Slice(pods, func(i, j int) bool {
+		return pods[i].Path < pods[j].Path
+	})
+	return pods, err
+}
+
+// loadPod loads the pod in the given directory returning nil if it is not a pod directory
+func (o *Options) loadPod(dir string) (*PodSummary, error) {
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(o.Dir, dir)
+	if err != nil {
+		return nil, err
+	}
+	pod := &PodSummary{
+		Name:   filepath.Base(dir),
+		Path:   filepath.ToSlash(rel),
+		Status: StatusUnknown,
+	}
+	containers := map[string]*ContainerSummary{}
+	found := false
+	for _, f := range fileInfos {
+		name := f.Name()
+		if f.IsDir() {
+			continue
+		}
+		switch name {
+		case logfiles.MetadataFileName:
+			found = true
+		case logfiles.EventsFileName:
+			pod.EventsPath = pod.Path + "/" + name
+		case logfiles.CombinedLogFileName:
+		default:
+			base := strings.TrimSuffix(name, logfiles.GzipExtension)
+			if !strings.HasSuffix(base, logfiles.LogExtension) {
+				continue
+			}
+			container := strings.TrimSuffix(base, logfiles.LogExtension)
+			found = true
+			containers[container] = &ContainerSummary{
+				Name:    container,
+				LogPath: pod.Path + "/" + container + logfiles.LogExtension,
+			}
+		}
+	}
+	if !found {
+		return nil, nil
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, logfiles.MetadataFileName))
+	if err == nil {
+		m := &podMetadata{}
+		err = json.Unmarshal(data, m)
+		if err != nil {
+			return nil, err
+		}
+		pod.Namespace = m.Namespace
+		pod.Name = m.Name
+		pod.Labels = m.Labels
+		pod.Phase = m.Phase
+		for _, c := range m.Containers {
+			cs := containers[c.Name]
+			if cs == nil {
+				cs = &ContainerSummary{Name: c.Name}
+			}
+			cs.Terminated = c.Terminated
+			cs.ExitCode = c.ExitCode
+			cs.Reason = c.Reason
+			cs.TruncatedBytes = c.TruncatedBytes
+			pod.Containers = append(pod.Containers, cs)
+			delete(containers, c.Name)
+		}
+	}
+	for _, c := range containers {
+		pod.Containers = append(pod.Containers, c)
+	}
+	sort.SliceStable(pod.Containers, func(i, j int) bool {
+		return pod.Containers[i].LogPath != "" && pod.Containers[j].LogPath == ""
+	})
+	if pod.Namespace == "" {
+		// lets assume the default layouts which start with the namespace
+		pod.Namespace = strings.SplitN(strings.TrimPrefix(pod.Path, filepath.ToSlash(o.LogPath)+"/"), "/", 2)[0]
+	}
+	pod.Status = podStatus(pod)
+	return pod, nil
+}
+
+// podStatus returns the status of the pod from its phase and containers
+func podStatus(pod *PodSummary) string {
+	switch pod.Phase {
+	case "Succeeded":
+		return StatusSucceeded
+	case "Failed":
+		return StatusFailed
+	case "":
+		return StatusUnknown
+	}
+	for _, c := range pod.Containers {
+		if c.Terminated && c.ExitCode != 0 {
+			return StatusFailed
+		}
+	}
+	return StatusRunning
+}
+
+// podsStatus returns the status of a pipeline run from the status of its pods
+func podsStatus(pods []*PodSummary) string {
+	status := StatusUnknown
+	for _, pod := range pods {
+		switch pod.Status {
+		case StatusFailed:
+			return StatusFailed
+		case StatusRunning:
+			status = StatusRunning
+		case StatusSucceeded:
+			if status == StatusUnknown {
+				status = StatusSucceeded
+			}
+		}
+	}
+	return status
+}
+
+// loadResources returns the headers of the Pod and PipelineActivity resources indexed by their path
+// relative to the work directory. The cache is rebuilt from the files found so that the entries of
+// deleted and evicted files are removed
+func (o *Options) loadResources() map[string]*resourceHeader {
+	o.resources.lock.Lock()
+	defer o.resources.lock.Unlock()
+
+	entries := map[string]*resourceEntry{}
+	answer := map[string]*resourceHeader{}
+	resourceDir := filepath.Join(o.Dir, o.ResourcePath)
+	err := filepath.Walk(resourceDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".yaml") {
+			return nil
+		}
+		rel, err := filepath.Rel(o.Dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		entry := o.resources.entries[rel]
+		if entry == nil || !entry.modTime.Equal(info.ModTime()) {
+			entry = &resourceEntry{modTime: info.ModTime()}
+			data, err := ioutil.ReadFile(path)
+			if err == nil {
+				header := &resourceHeader{}
+				if yaml.Unmarshal(data, header) == nil {
+					entry.header = header
+				}
+			}
+		}
+		entries[rel] = entry
+		if entry.header != nil && (entry.header.Kind == "Pod" || entry.header.Kind == "PipelineActivity") {
+			answer[rel] = entry.header
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.WithError(err).Warnf("failed to load resources from %s", resourceDir)
+
+		// lets keep the entries of the files which were not walked
+		for k, v := range o.resources.entries {
+			if entries[k] == nil {
+				entries[k] = v
+			}
+		}
+	}
+	o.resources.entries = entries
+	return answer
+}
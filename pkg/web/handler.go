@@ -4,7 +4,11 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/jenkins-x/jx-test-collector/pkg/metrics"
+	"github.com/jenkins-x/jx-test-collector/pkg/search"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
 
@@ -13,8 +17,51 @@ type Options struct {
 	// Port the port to listen on HTTP
 	Port int `env:"PORT"`
 
-	// Sync performs the sync operation
-	Sync func() (string, error)
+	// Dir the work directory containing the collected logs and resources
+	Dir string
+
+	// LogPath the path within Dir of the pod logs
+	LogPath string
+
+	// ResourcePath the path within Dir of the kubernetes resources
+	ResourcePath string
+
+	// Sync performs the sync operation returning the record of the sync which is added to the History
+	Sync func() (*SyncRecord, error)
+
+	// Logs finds and follows container logs
+	Logs LogStreamer
+
+	// Targets lists the containers whose logs are being collected
+	Targets TargetLister
+
+	// ResourceFile returns the file name of the YAML of a resource
+	ResourceFile func(group, version, resource, namespace, name string) (string, error)
+
+	// Search the index of the most recent log lines
+	Search *search.Index
+
+	// History the history of syncs
+	History SyncHistory
+
+	// Ready returns an error if the service is not ready such as when the disk is too full
+	Ready func() error
+
+	// Live returns an error if the service is broken and should be restarted
+	Live func() error
+
+	// Auth the configuration of the authentication of the endpoints
+	Auth AuthOptions
+
+	// Authorizer checks the permissions of requests. If nil all requests are allowed
+	Authorizer Authorizer
+
+	// CatalogCacheDuration how long the catalog of pipeline runs and pods shown on the index page is cached.
+	// Zero disables the cache
+	CatalogCacheDuration time.Duration `env:"CATALOG_CACHE_DURATION,default=10s"`
+
+	resources resourceCache
+	catalog   catalogCache
 }
 
 const (
@@ -24,8 +71,11 @@ const (
 	// ReadyPath URL path for the HTTP endpoint that returns ready status.
 	ReadyPath = "/ready"
 
-	// SyncPath to invoke a sync operation
+	// SyncPath to invoke a sync operation with POST
 	SyncPath = "/sync"
+
+	// SyncStatusPath returns the most recent syncs and the next scheduled sync
+	SyncStatusPath = "/sync/status"
 )
 
 // Run will implement this command
@@ -33,46 +83,82 @@ func (o *Options) Run() error {
 	if o.Port == 0 {
 		o.Port = 8080
 	}
+	logrus.Infof("jx-test-collector is now listening port %d", o.Port)
+	return http.ListenAndServe(":"+strconv.Itoa(o.Port), o.Handler())
+}
+
+// Handler returns the HTTP handler for all the endpoints
+func (o *Options) Handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.Handle(HealthPath, http.HandlerFunc(o.health))
 	mux.Handle(ReadyPath, http.HandlerFunc(o.ready))
-	mux.Handle("/", http.HandlerFunc(o.index))
-	mux.Handle(SyncPath, http.HandlerFunc(o.sync))
-
-	logrus.Infof("jx-test-collector is now listening port %d", o.Port)
-	return http.ListenAndServe(":"+strconv.Itoa(o.Port), mux)
+	mux.Handle("/", o.authorize(PermissionRead, o.index))
+	mux.Handle(SyncPath, o.authorize(PermissionTrigger, o.sync))
+	mux.Handle(SyncStatusPath, o.authorize(PermissionRead, o.syncStatus))
+	mux.Handle(LogsPath, o.authorize(PermissionRead, o.logs))
+	mux.Handle(UIPodPath, o.authorize(PermissionRead, o.pod))
+	mux.Handle(UIFilePath, o.authorize(PermissionRead, o.file))
+	mux.Handle(UIBrowsePath, o.authorize(PermissionRead, o.browse))
+	mux.Handle(APITargetsPath, o.authorize(PermissionRead, o.targets))
+	mux.Handle(APIResourcesPath, o.authorize(PermissionRead, o.resource))
+	mux.Handle(APISyncsPath, o.authorize(PermissionRead, o.syncs))
+	mux.Handle(APISearchPath, o.authorize(PermissionRead, o.searchLogs))
+	mux.Handle(metrics.Path, metrics.Handler())
+	return mux
 }
 
-// health returns either HTTP 204 if the service is healthy, otherwise nothing ('cos it's dead).
+// health returns either HTTP 204 if the service is healthy, otherwise HTTP 503.
 func (o *Options) health(w http.ResponseWriter, r *http.Request) {
 	logrus.Debug("Health check")
-	w.WriteHeader(http.StatusNoContent)
+	err := o.isLive()
+	if err == nil {
+		w.WriteHeader(http.StatusNoContent)
+	} else {
+		logrus.WithError(err).Warn("health check failed")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(err.Error()))
+	}
 }
 
 // ready returns either HTTP 204 if the service is ready to serve requests, otherwise HTTP 503.
 func (o *Options) ready(w http.ResponseWriter, r *http.Request) {
 	logrus.Debug("Ready check")
-	if o.isReady() {
+	err := o.isReady()
+	if err == nil {
 		w.WriteHeader(http.StatusNoContent)
 	} else {
 		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(err.Error()))
 	}
 }
 
-func (o *Options) index(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("hello from jx-test-collector"))
-}
-
+// sync performs a sync returning the JSON record of the sync
 func (o *Options) sync(w http.ResponseWriter, r *http.Request) {
-	text, err := o.Sync()
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("failed to sync: %s", err.Error())))
+	record, err := o.Sync()
+	if record == nil {
+		if err == nil {
+			err = errors.Errorf("no sync performed")
+		}
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to sync: %s", err.Error()))
 		return
 	}
-	w.Write([]byte(text))
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusInternalServerError
+	}
+	writeJSON(w, status, record)
 }
 
-func (o *Options) isReady() bool {
-	return true
+func (o *Options) isReady() error {
+	if o.Ready == nil {
+		return nil
+	}
+	return o.Ready()
+}
+
+func (o *Options) isLive() error {
+	if o.Live == nil {
+		return nil
+	}
+	return o.Live()
 }
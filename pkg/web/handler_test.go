@@ -0,0 +1,34 @@
+package web_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/web"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthAndReady(t *testing.T) {
+	var readyErr, liveErr error
+	o := &web.Options{
+		Ready: func() error {
+			return readyErr
+		},
+		Live: func() error {
+			return liveErr
+		},
+	}
+	server := httptest.NewServer(o.Handler())
+	defer server.Close()
+
+	get(t, server.URL+web.HealthPath, http.StatusNoContent)
+	get(t, server.URL+web.ReadyPath, http.StatusNoContent)
+
+	readyErr = errors.Errorf("the pod watch is not running")
+	liveErr = errors.Errorf("the last 3 syncs failed")
+
+	assert.Equal(t, "the last 3 syncs failed", get(t, server.URL+web.HealthPath, http.StatusServiceUnavailable))
+	assert.Equal(t, "the pod watch is not running", get(t, server.URL+web.ReadyPath, http.StatusServiceUnavailable))
+}
@@ -0,0 +1,178 @@
+package web
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/logfiles"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// LogsPath the URL path prefix for the HTTP endpoint which serves container logs
+	// using the path /logs/{namespace}/{pod}/{container}
+	LogsPath = "/logs/"
+)
+
+// LogStreamer finds the stored logs of containers and follows the lines as they are written
+type LogStreamer interface {
+	// LogFile returns the file name of the stored masked log of the container
+	// or an error satisfying os.IsNotExist if the container is unknown
+	LogFile(namespace, pod, container string) (string, error)
+
+	// Follow subscribes to the lines written to the log of the container
+	// returning nil if the container log is no longer being written
+	Follow(namespace, pod, container string) *Subscription
+}
+
+// Subscription the lines written to a container log after a subscription was made
+type Subscription struct {
+	// Lines the lines written to the log after the first Offset lines.
+	// The channel is closed when the log is complete or the subscriber is too slow to keep up
+	Lines <-chan string
+
+	// Offset the number of lines in the log file when the subscription was made
+	Offset int
+
+	// Cancel cancels the subscription
+	Cancel func()
+}
+
+// logs serves the stored log of a container and, if the follow parameter is true, streams new lines
+// as they are written. Server-Sent Events are used if requested via the Accept header
+func (o *Options) logs(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, LogsPath), "/"), "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		http.Error(w, "expected path "+LogsPath+"{namespace}/{pod}/{container}", http.StatusBadRequest)
+		return
+	}
+	if o.Logs == nil {
+		http.NotFound(w, r)
+		return
+	}
+	ns, pod, container := parts[0], parts[1], parts[2]
+
+	fileName, err := o.Logs.LogFile(ns, pod, container)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, fmt.Sprintf("failed to find log: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	var sub *Subscription
+	if r.URL.Query().Get("follow") == "true" {
+		sub = o.Logs.Follow(ns, pod, container)
+		if sub != nil {
+			defer sub.Cancel()
+		}
+	}
+
+	f, err := logfiles.Open(fileName)
+	if err != nil && !(os.IsNotExist(err) && sub != nil) {
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, fmt.Sprintf("failed to open log: %s", err.Error()), http.StatusInternalServerError)
+		return
+	}
+
+	out := newLineWriter(w, strings.Contains(r.Header.Get("Accept"), "text/event-stream"))
+	if f != nil {
+		defer f.Close()
+
+		maxLines := -1
+		if sub != nil {
+			// lets only serve the lines written before subscribing to avoid duplicates
+			maxLines = sub.Offset
+		}
+		err = out.copyLines(f, maxLines)
+		if err != nil {
+			logrus.WithError(err).Debugf("failed to write log %s", fileName)
+			return
+		}
+	}
+	out.flush()
+	if sub == nil {
+		return
+	}
+
+	for {
+		select {
+		case line, ok := <-sub.Lines:
+			if !ok {
+				return
+			}
+			err = out.writeLine(line)
+			if err != nil {
+				return
+			}
+			out.flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// lineWriter writes lines as plain text or as Server-Sent Events
+type lineWriter struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	events  bool
+}
+
+func newLineWriter(w http.ResponseWriter, events bool) *lineWriter {
+	if events {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	flusher, _ := w.(http.Flusher)
+	return &lineWriter{w: w, flusher: flusher, events: events}
+}
+
+// copyLines copies up to the maximum number of lines from the reader or all the lines if the maximum is negative
+func (l *lineWriter) copyLines(r io.Reader, maxLines int) error {
+	reader := bufio.NewReader(r)
+	for count := 0; maxLines < 0 || count < maxLines; count++ {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			werr := l.writeLine(strings.TrimSuffix(line, "\n"))
+			if werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *lineWriter) writeLine(line string) error {
+	var err error
+	if l.events {
+		_, err = io.WriteString(l.w, "data: "+strings.ReplaceAll(line, "\n", "\ndata: ")+"\n\n")
+	} else {
+		_, err = io.WriteString(l.w, line+"\n")
+	}
+	return err
+}
+
+func (l *lineWriter) flush() {
+	if l.flusher != nil {
+		l.flusher.Flush()
+	}
+}
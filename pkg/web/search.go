@@ -0,0 +1,73 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/search"
+)
+
+const (
+	// APISearchPath searches the collected logs using the q parameter
+	APISearchPath = APIPath + "search"
+)
+
+// SearchResponse the results of a search
+type SearchResponse struct {
+	Query   string          `json:"query"`
+	Results []*SearchResult `json:"results"`
+}
+
+// SearchResult a matching line with links to its log
+type SearchResult struct {
+	*search.Result
+
+	// FileURL the URL of the stored log file
+	FileURL string `json:"fileURL"`
+
+	// LogURL the URL to follow the container log
+	LogURL string `json:"logURL"`
+}
+
+// searchLogs searches the most recent log lines for the q parameter optionally filtered by namespace, pod
+// and pipelineRun and limited by the limit parameter
+func (o *Options) searchLogs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	query := q.Get("q")
+	if len(search.Tokenize(query)) == 0 {
+		writeError(w, http.StatusBadRequest, "missing q parameter")
+		return
+	}
+	limit := 0
+	if text := q.Get("limit"); text != "" {
+		var err error
+		limit, err = strconv.Atoi(text)
+		if err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit parameter")
+			return
+		}
+	}
+	ns := q.Get("namespace")
+	pod := q.Get("pod")
+	pipelineRun := q.Get("pipelineRun")
+	filter := func(c *search.Context) bool {
+		return (ns == "" || c.Namespace == ns) && (pod == "" || c.Pod == pod) && (pipelineRun == "" || c.PipelineRun == pipelineRun)
+	}
+
+	answer := &SearchResponse{
+		Query:   query,
+		Results: []*SearchResult{},
+	}
+	if o.Search != nil {
+		for _, r := range o.Search.Search(query, limit, filter) {
+			answer.Results = append(answer.Results, &SearchResult{
+				Result:  r,
+				FileURL: UIFilePath + "?path=" + url.QueryEscape(r.LogFile),
+				LogURL:  LogsPath + path.Join(url.PathEscape(r.Namespace), url.PathEscape(r.Pod), url.PathEscape(r.Container)),
+			})
+		}
+	}
+	writeJSON(w, http.StatusOK, answer)
+}
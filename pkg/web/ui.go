@@ -0,0 +1,276 @@
+package web
+
+import (
+	"html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/jenkins-x/jx-test-collector/pkg/logfiles"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// UIPodPath the URL path of the page showing a pod directory using the path parameter
+	UIPodPath = "/ui/pod"
+
+	// UIFilePath the URL path serving a log or resource file using the path parameter
+	UIFilePath = "/ui/file"
+
+	// UIBrowsePath the URL path of the page listing a directory using the path parameter
+	UIBrowsePath = "/ui/browse"
+)
+
+var (
+	uiFuncs = template.FuncMap{
+		"podURL":    func(p string) string { return UIPodPath + "?path=" + url.QueryEscape(p) },
+		"fileURL":   func(p string) string { return UIFilePath + "?path=" + url.QueryEscape(p) },
+		"browseURL": func(p string) string { return UIBrowsePath + "?path=" + url.QueryEscape(p) },
+		"statusClass": func(status string) string {
+			return "status-" + strings.ToLower(status)
+		},
+	}
+
+	indexTemplate  = template.Must(template.New("index").Funcs(uiFuncs).Parse(uiLayout + indexBody))
+	podTemplate    = template.Must(template.New("pod").Funcs(uiFuncs).Parse(uiLayout + podBody))
+	browseTemplate = template.Must(template.New("browse").Funcs(uiFuncs).Parse(uiLayout + browseBody))
+)
+
+const uiLayout = `{{ define "header" }}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { text-align: left; padding: 0.3em 1em 0.3em 0; border-bottom: 1px solid #ddd; }
+.status-succeeded { color: #1a7f37; }
+.status-failed { color: #cf222e; }
+.status-running, .status-pending { color: #9a6700; }
+.status-unknown { color: #57606a; }
+</style>
+</head>
+<body>
+<p><a href="/">pipelines</a> | <a href="{{ browseURL "" }}">files</a></p>
+<h1>{{ .Title }}</h1>
+{{ end }}
+{{ define "footer" }}</body>
+</html>
+{{ end }}`
+
+const indexBody = `{{ template "header" . }}
+{{ if not .Catalog.Namespaces }}<p>no logs have been collected yet</p>{{ end }}
+{{ range .Catalog.Namespaces }}
+<h2>{{ .Name }}</h2>
+{{ if .Runs }}
+<table>
+<tr><th>Repository</th><th>Branch</th><th>Build</th><th>Status</th><th>Started</th><th>Pods</th></tr>
+{{ range .Runs }}<tr>
+<td>{{ .Owner }}/{{ .Repository }}</td>
+<td>{{ .Branch }}</td>
+<td>{{ if .ResourcePath }}<a href="{{ fileURL .ResourcePath }}">{{ .Build }}</a>{{ else }}{{ .Build }}{{ end }}</td>
+<td class="{{ statusClass .Status }}">{{ .Status }}</td>
+<td>{{ .Started }}</td>
+<td>{{ range .Pods }}<a href="{{ podURL .Path }}">{{ .Name }}</a> {{ end }}</td>
+</tr>{{ end }}
+</table>
+{{ end }}
+<table>
+<tr><th>Pod</th><th>Status</th><th>Containers</th></tr>
+{{ range .Pods }}<tr>
+<td><a href="{{ podURL .Path }}">{{ .Name }}</a></td>
+<td class="{{ statusClass .Status }}">{{ .Status }}</td>
+<td>{{ range .Containers }}{{ if .LogPath }}<a href="{{ fileURL .LogPath }}">{{ .Name }}</a> {{ end }}{{ end }}</td>
+</tr>{{ end }}
+</table>
+{{ end }}
+{{ template "footer" . }}`
+
+const podBody = `{{ template "header" . }}
+<table>
+<tr><th>Namespace</th><td>{{ .Pod.Namespace }}</td></tr>
+<tr><th>Status</th><td class="{{ statusClass .Pod.Status }}">{{ .Pod.Status }}</td></tr>
+{{ with .Pod.ResourcePath }}<tr><th>Resource</th><td><a href="{{ fileURL . }}">YAML</a></td></tr>{{ end }}
+{{ with .Pod.EventsPath }}<tr><th>Events</th><td><a href="{{ fileURL . }}">events</a></td></tr>{{ end }}
+<tr><th>Files</th><td><a href="{{ browseURL .Pod.Path }}">{{ .Pod.Path }}</a></td></tr>
+</table>
+<table>
+<tr><th>Container</th><th>Terminated</th><th>Exit Code</th><th>Reason</th><th>Truncated Bytes</th></tr>
+{{ range .Pod.Containers }}<tr>
+<td>{{ if .LogPath }}<a href="{{ fileURL .LogPath }}">{{ .Name }}</a>{{ else }}{{ .Name }}{{ end }}</td>
+<td>{{ .Terminated }}</td>
+<td>{{ if .Terminated }}{{ .ExitCode }}{{ end }}</td>
+<td>{{ .Reason }}</td>
+<td>{{ if .TruncatedBytes }}{{ .TruncatedBytes }}{{ end }}</td>
+</tr>{{ end }}
+</table>
+{{ template "footer" . }}`
+
+const browseBody = `{{ template "header" . }}
+{{ with .Parent }}<p><a href="{{ browseURL . }}">..</a></p>{{ end }}
+<table>
+{{ range .Files }}<tr><td>{{ if .IsDir }}<a href="{{ browseURL .Path }}">{{ .Name }}/</a>{{ else }}<a href="{{ fileURL .Path }}">{{ .Name }}</a>{{ end }}</td></tr>
+{{ end }}
+</table>
+{{ template "footer" . }}`
+
+// browseFile a file or directory in a directory listing
+type browseFile struct {
+	Name  string
+	Path  string
+	IsDir bool
+}
+
+// index renders the pipeline runs and pods found in the work directory
+func (o *Options) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	catalog, err := o.CachedCatalog()
+	if err != nil {
+		http.Error(w, "failed to load catalog: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	o.render(w, indexTemplate, map[string]interface{}{
+		"Title":   "jx-test-collector",
+		"Catalog": catalog,
+	})
+}
+
+// pod renders the containers, events and resource of a pod directory
+func (o *Options) pod(w http.ResponseWriter, r *http.Request) {
+	dir, _, err := o.workPath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pod, err := o.loadPod(dir)
+	if err != nil && !os.IsNotExist(err) {
+		http.Error(w, "failed to load pod: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if pod == nil {
+		http.NotFound(w, r)
+		return
+	}
+	for resourcePath, header := range o.loadResources() {
+		if header.Kind == "Pod" && header.Metadata.Namespace == pod.Namespace && header.Metadata.Name == pod.Name {
+			pod.ResourcePath = resourcePath
+		}
+	}
+	o.render(w, podTemplate, map[string]interface{}{
+		"Title": pod.Name,
+		"Pod":   pod,
+	})
+}
+
+// file serves a log or resource file as text, decompressing compressed logs
+func (o *Options) file(w http.ResponseWriter, r *http.Request) {
+	fileName, rel, err := o.workPath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	info, err := os.Stat(fileName)
+	if err == nil && info.IsDir() {
+		http.Redirect(w, r, UIBrowsePath+"?path="+url.QueryEscape(rel), http.StatusFound)
+		return
+	}
+	f, err := logfiles.Open(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "failed to open file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	_, err = io.Copy(w, f)
+	if err != nil {
+		logrus.WithError(err).Debugf("failed to write file %s", fileName)
+	}
+}
+
+// browse lists the files in a directory of the work directory
+func (o *Options) browse(w http.ResponseWriter, r *http.Request) {
+	dir, rel, err := o.workPath(r.URL.Query().Get("path"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, "failed to read directory: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	var files []browseFile
+	for _, f := range fileInfos {
+		name := f.Name()
+		if rel == "" && strings.HasPrefix(name, ".") {
+			continue
+		}
+		p := path.Join(rel, name)
+		if strings.HasSuffix(name, logfiles.LogExtension+logfiles.GzipExtension) {
+			// compressed logs are decompressed when served using the name of the log file
+			p = strings.TrimSuffix(p, logfiles.GzipExtension)
+		}
+		files = append(files, browseFile{
+			Name:  name,
+			Path:  p,
+			IsDir: f.IsDir(),
+		})
+	}
+	parent := ""
+	if rel != "" {
+		parent = path.Dir(rel)
+		if parent == "." {
+			parent = "/"
+		}
+	}
+	title := rel
+	if title == "" {
+		title = "files"
+	}
+	o.render(w, browseTemplate, map[string]interface{}{
+		"Title":  title,
+		"Parent": parent,
+		"Files":  files,
+	})
+}
+
+func (o *Options) render(w http.ResponseWriter, t *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := t.Execute(w, data)
+	if err != nil {
+		logrus.WithError(err).Warnf("failed to render template %s", t.Name())
+	}
+}
+
+// workPath validates the slash separated path relative to the work directory returning the file name
+// and the cleaned relative path. Paths outside of the work directory or inside the .git directory are rejected
+func (o *Options) workPath(p string) (string, string, error) {
+	if o.Dir == "" {
+		return "", "", errors.Errorf("no work directory")
+	}
+	rel := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if rel == ".git" || strings.HasPrefix(rel, ".git/") {
+		return "", "", errors.Errorf("invalid path %s", p)
+	}
+	return filepath.Join(o.Dir, filepath.FromSlash(rel)), rel, nil
+}
@@ -0,0 +1,146 @@
+package web_test
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jenkins-x/jx-helpers/v3/pkg/files"
+	"github.com/jenkins-x/jx-test-collector/pkg/web"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUI(t *testing.T) {
+	tmpDir := createWorkDir(t)
+
+	o := &web.Options{
+		Dir:          tmpDir,
+		LogPath:      "logs",
+		ResourcePath: "resources",
+	}
+	server := httptest.NewServer(o.Handler())
+	defer server.Close()
+
+	podPath := "logs/jx/tekton-pipelines/myorg/myrepo/PR-1/myorg-myrepo-pr-1-2-pod"
+
+	body := get(t, server.URL+"/", http.StatusOK)
+	assert.Contains(t, body, "myorg/myrepo", "index should contain the repository")
+	assert.Contains(t, body, "PR-1", "index should contain the branch")
+	assert.Contains(t, body, `<td class="status-failed">Failed</td>`, "index should contain the status")
+	assert.Contains(t, body, url.QueryEscape(podPath), "index should link to the pod")
+
+	body = get(t, server.URL+web.UIPodPath+"?path="+url.QueryEscape(podPath), http.StatusOK)
+	assert.Contains(t, body, "step-test", "pod page should contain the container")
+	assert.Contains(t, body, url.QueryEscape("resources/core/v1/pods/jx/myorg-myrepo-pr-1-2-pod.yaml"), "pod page should link to the pod YAML")
+
+	body = get(t, server.URL+web.UIFilePath+"?path="+url.QueryEscape(podPath+"/step-test.log"), http.StatusOK)
+	assert.Equal(t, "running tests\nFAIL\n", body, "compressed log")
+
+	body = get(t, server.URL+web.UIBrowsePath+"?path="+url.QueryEscape(podPath), http.StatusOK)
+	assert.Contains(t, body, "step-test.log.gz", "directory listing")
+
+	get(t, server.URL+web.UIFilePath+"?path="+url.QueryEscape("../../etc/passwd"), http.StatusNotFound)
+	get(t, server.URL+web.UIFilePath+"?path="+url.QueryEscape(".git/config"), http.StatusBadRequest)
+	get(t, server.URL+"/does-not-exist", http.StatusNotFound)
+}
+
+func createWorkDir(t *testing.T) string {
+	tmpDir, err := ioutil.TempDir("", "test-jx-test-collector-")
+	require.NoError(t, err, "failed to create temp dir")
+
+	podDir := filepath.Join(tmpDir, "logs", "jx", "tekton-pipelines", "myorg", "myrepo", "PR-1", "myorg-myrepo-pr-1-2-pod")
+	writeFile(t, filepath.Join(podDir, "metadata.json"), `{
+  "namespace": "jx",
+  "name": "myorg-myrepo-pr-1-2-pod",
+  "labels": {"owner": "myorg", "repository": "myrepo", "branch": "PR-1", "build": "2"},
+  "phase": "Failed",
+  "containers": [
+    {"name": "step-build", "terminated": true, "exitCode": 0},
+    {"name": "step-test", "terminated": true, "exitCode": 1, "reason": "Error"}
+  ]
+}`)
+	writeFile(t, filepath.Join(podDir, "step-build.log"), "building\n")
+
+	fileName := filepath.Join(podDir, "step-test.log.gz")
+	f, err := os.Create(fileName)
+	require.NoError(t, err, "failed to create file %s", fileName)
+	w := gzip.NewWriter(f)
+	_, err = w.Write([]byte("running tests\nFAIL\n"))
+	require.NoError(t, err, "failed to write file %s", fileName)
+	require.NoError(t, w.Close(), "failed to close gzip writer")
+	require.NoError(t, f.Close(), "failed to close file %s", fileName)
+
+	writeFile(t, filepath.Join(tmpDir, "resources", "jenkins.io", "v1", "pipelineactivities", "jx", "myorg-myrepo-pr-1-2.yaml"), `apiVersion: jenkins.io/v1
+kind: PipelineActivity
+metadata:
+  name: myorg-myrepo-pr-1-2
+  namespace: jx
+spec:
+  gitOwner: myorg
+  gitRepository: myrepo
+  gitBranch: PR-1
+  build: "2"
+  status: Failed
+  startedTimestamp: "2021-06-01T10:00:00Z"
+`)
+	writeFile(t, filepath.Join(tmpDir, "resources", "core", "v1", "pods", "jx", "myorg-myrepo-pr-1-2-pod.yaml"), `apiVersion: v1
+kind: Pod
+metadata:
+  name: myorg-myrepo-pr-1-2-pod
+  namespace: jx
+`)
+	return tmpDir
+}
+
+func writeFile(t *testing.T, fileName, text string) {
+	err := os.MkdirAll(filepath.Dir(fileName), files.DefaultDirWritePermissions)
+	require.NoError(t, err, "failed to create dir for %s", fileName)
+	err = ioutil.WriteFile(fileName, []byte(text), files.DefaultFileWritePermissions)
+	require.NoError(t, err, "failed to save file %s", fileName)
+}
+
+func get(t *testing.T, u string, expectedStatus int) string {
+	resp, err := http.Get(u)
+	require.NoError(t, err, "failed to get %s", u)
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err, "failed to read %s", u)
+	assert.Equal(t, expectedStatus, resp.StatusCode, "status of %s", u)
+	return string(data)
+}
+
+func TestCachedCatalog(t *testing.T) {
+	tmpDir := createWorkDir(t)
+
+	o := &web.Options{
+		Dir:                  tmpDir,
+		LogPath:              "logs",
+		ResourcePath:         "resources",
+		CatalogCacheDuration: time.Hour,
+	}
+	catalog, err := o.CachedCatalog()
+	require.NoError(t, err, "failed to load catalog")
+	require.Len(t, catalog.Namespaces, 1, "namespaces")
+
+	writeFile(t, filepath.Join(tmpDir, "logs", "other", "myapp", "myapp-abc", "myapp.log"), "started\n")
+
+	cached, err := o.CachedCatalog()
+	require.NoError(t, err, "failed to load cached catalog")
+	assert.True(t, catalog == cached, "the catalog should be cached")
+
+	catalog, err = o.LoadCatalog()
+	require.NoError(t, err, "failed to load catalog")
+	assert.Len(t, catalog.Namespaces, 2, "namespaces after the new pod")
+
+	o.CatalogCacheDuration = 0
+	catalog, err = o.CachedCatalog()
+	require.NoError(t, err, "failed to load catalog")
+	assert.Len(t, catalog.Namespaces, 2, "namespaces when the cache is disabled")
+}